@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+const (
+	// accountPurgeInterval is how often accounts past their grace period are deleted
+	accountPurgeInterval = time.Hour
+	// accountPurgeBatch is how many accounts one purge deletes at most
+	accountPurgeBatch = 100
+	// exportPageSize is how many rows an export reads per query
+	exportPageSize = 100
+)
+
+type deleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type deleteAccountResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// deleteAccount schedules the account of the caller for deletion once the
+// grace period is over and signs them out everywhere. Signing in again before
+// then keeps the account.
+func (server *Server) deleteAccount(ctx *gin.Context) {
+	var req deleteAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !server.confirmPassword(ctx, user, req.Password) {
+		return
+	}
+	deletion, err := server.store.ScheduleAccountDeletion(ctx, db.ScheduleAccountDeletionParams{
+		Username:    user.Username,
+		DeleteAfter: time.Now().Add(server.config.AccountDeletionGracePeriod),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.endUserSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.revocations.RevokeUser(ctx, user.Username, server.maxTokenLifetime())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// API keys are not tied to a session, they stay revoked if the deletion is called off
+	err = server.store.RevokeUserApiKeys(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.Email.Valid {
+		err = server.notifier.Notify(ctx, notify.Message{
+			Type:  notify.TypeAccountDeletionScheduled,
+			Email: user.Email.String,
+			Summary: fmt.Sprintf(
+				"Your account %s and its data will be deleted for good on %s.",
+				user.Username, deletion.DeleteAfter.UTC().Format(time.RFC1123),
+			),
+		})
+		if err != nil {
+			log.Print("Can't send account deletion email: ", err)
+		}
+	}
+	ctx.JSON(http.StatusAccepted, deleteAccountResponse{DeleteAfter: deletion.DeleteAfter})
+}
+
+// purgeDeletedAccounts deletes the accounts whose grace period is over and
+// tells other services about it. The event is published before the deletion
+// commits, so a failed publish leaves the account to the next purge and
+// consumers may see an event twice.
+func (server *Server) purgeDeletedAccounts(ctx context.Context) error {
+	deletions, err := server.store.ListDueAccountDeletions(ctx, accountPurgeBatch)
+	if err != nil {
+		return err
+	}
+	for _, deletion := range deletions {
+		_, err := server.store.DeleteAccountTx(ctx, db.DeleteAccountTxParams{
+			Username: deletion.Username,
+			AfterDelete: func(user db.User) error {
+				return server.notifier.Publish(ctx, notify.Event{
+					Type:       notify.EventUserDeleted,
+					Username:   user.Username,
+					OccurredAt: time.Now(),
+				})
+			},
+		})
+		// the owner signed in since the deletions were listed
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot delete account %s: %w", deletion.Username, err)
+		}
+	}
+	return nil
+}
+
+// runAccountPurge purges deleted accounts every interval until ctx is done
+func (server *Server) runAccountPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := server.purgeDeletedAccounts(ctx); err != nil {
+			log.Print("Can't purge deleted accounts: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type accountProfile struct {
+	Username      string    `json:"username"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	About         string    `json:"about"`
+	Photo         string    `json:"photo"`
+	Role          string    `json:"role"`
+	TotpEnabled   bool      `json:"totp_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type exportedSession struct {
+	sessionResponse
+	Blocked bool `json:"blocked"`
+}
+
+// accountExport is everything the service keeps about a user, short of
+// secrets like password hashes and tokens
+type accountExport struct {
+	ExportedAt      time.Time           `json:"exported_at"`
+	Profile         accountProfile      `json:"profile"`
+	UsernameHistory []db.UsernameChange `json:"username_history"`
+	Sessions        []exportedSession   `json:"sessions"`
+	LoginHistory    []db.LoginEvent     `json:"login_history"`
+	Impersonations  []db.Impersonation  `json:"impersonations"`
+}
+
+// listAll collects every page of a paginated query
+func listAll[T any](list func(limit int32, offset int32) ([]T, error)) ([]T, error) {
+	items := []T{}
+	for offset := int32(0); ; offset += exportPageSize {
+		page, err := list(exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if len(page) < exportPageSize {
+			return items, nil
+		}
+	}
+}
+
+// heldUsername is a name a user had from From until Until
+type heldUsername struct {
+	Username string
+	From     time.Time
+	Until    time.Time
+}
+
+// heldUsernames returns the names user had, from history newest first, with
+// the period they had each. Outside of it the name may have been someone else's.
+func heldUsernames(user db.User, history []db.UsernameChange, now time.Time) []heldUsername {
+	held := make([]heldUsername, 0, len(history)+1)
+	from := user.CreatedAt
+	for i := len(history) - 1; i >= 0; i-- {
+		held = append(held, heldUsername{Username: history[i].OldUsername, From: from, Until: history[i].ChangedAt})
+		from = history[i].ChangedAt
+	}
+	return append(held, heldUsername{Username: user.Username, From: from, Until: now})
+}
+
+// exportAccount hands the caller a JSON archive of the data kept about them
+func (server *Server) exportAccount(ctx *gin.Context) {
+	exportedAt := time.Now()
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	sessions, err := server.store.ListAllUserSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	loginHistory, err := listAll(func(limit int32, offset int32) ([]db.LoginEvent, error) {
+		return server.store.ListLoginEvents(ctx, db.ListLoginEventsParams{
+			Username: user.Username,
+			Limit:    limit,
+			Offset:   offset,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	usernameHistory, err := server.store.ListUsernameChanges(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the audit trail keeps the names users had at the time
+	impersonations := []db.Impersonation{}
+	for _, held := range heldUsernames(user, usernameHistory, exportedAt) {
+		page, err := listAll(func(limit int32, offset int32) ([]db.Impersonation, error) {
+			return server.store.ListImpersonations(ctx, db.ListImpersonationsParams{
+				TargetUsername: held.Username,
+				Limit:          limit,
+				Offset:         offset,
+			})
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		for _, impersonation := range page {
+			if !impersonation.CreatedAt.Before(held.From) && impersonation.CreatedAt.Before(held.Until) {
+				impersonations = append(impersonations, impersonation)
+			}
+		}
+	}
+	rsp := accountExport{
+		ExportedAt: exportedAt,
+		Profile: accountProfile{
+			Username:      user.Username,
+			Name:          user.Name,
+			Email:         user.Email.String,
+			EmailVerified: user.EmailVerified,
+			About:         user.About,
+			Photo:         user.Photo,
+			Role:          user.Role,
+			TotpEnabled:   user.TotpEnabled,
+			CreatedAt:     user.CreatedAt,
+		},
+		UsernameHistory: usernameHistory,
+		Sessions:        make([]exportedSession, 0, len(sessions)),
+		LoginHistory:    loginHistory,
+		Impersonations:  impersonations,
+	}
+	for _, session := range sessions {
+		rsp.Sessions = append(rsp.Sessions, exportedSession{
+			sessionResponse: newSessionResponse(session, authPayload),
+			Blocked:         session.IsBlocked,
+		})
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.json"`, user.Username))
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	alice := loginWithUserAgent(t, server, "alice", firefoxLinux)
+	bob := loginWithUserAgent(t, server, "bob", firefoxLinux)
+
+	recorder := serveJSON(t, server, http.MethodDelete, "/", gin.H{}, alice.AccessToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodDelete, "/", gin.H{"password": "wrong"}, alice.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Empty(t, store.deletions)
+
+	recorder = serveJSON(t, server, http.MethodDelete, "/", gin.H{"password": "secret"}, alice.AccessToken)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var rsp deleteAccountResponse
+	decodeJSON(t, recorder, &rsp)
+	require.WithinDuration(t, time.Now().Add(server.config.AccountDeletionGracePeriod), rsp.DeleteAfter, time.Minute)
+	require.Contains(t, store.deletions, "alice")
+	last := notifier.messages[len(notifier.messages)-1]
+	require.Equal(t, notify.TypeAccountDeletionScheduled, last.Type)
+	require.Equal(t, "alice@example.com", last.Email)
+
+	// the owner is signed out everywhere
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, alice.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": alice.RefreshToken}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// nothing is deleted during the grace period
+	require.NoError(t, server.purgeDeletedAccounts(context.Background()))
+	require.Contains(t, store.users, "alice")
+	require.Empty(t, notifier.events)
+
+	// signing in again keeps the account
+	alice = loginWithUserAgent(t, server, "alice", firefoxLinux)
+	require.Empty(t, store.deletions)
+
+	recorder = serveJSON(t, server, http.MethodDelete, "/", gin.H{"password": "secret"}, alice.AccessToken)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	deletion := store.deletions["alice"]
+	deletion.DeleteAfter = time.Now().Add(-time.Minute)
+	store.deletions["alice"] = deletion
+
+	require.NoError(t, server.purgeDeletedAccounts(context.Background()))
+	require.NotContains(t, store.users, "alice")
+	require.Empty(t, store.deletions)
+	for _, session := range store.sessions {
+		require.NotEqual(t, "alice", session.Username)
+	}
+	require.Len(t, notifier.events, 1)
+	require.Equal(t, notify.EventUserDeleted, notifier.events[0].Type)
+	require.Equal(t, "alice", notifier.events[0].Username)
+
+	// other accounts are left alone
+	require.Contains(t, store.users, "bob")
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, bob.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestExportAccount(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	loginWithUserAgent(t, server, "alice", safariIPhone)
+	alice := loginWithUserAgent(t, server, "alice", firefoxLinux)
+	loginWithUserAgent(t, server, "bob", firefoxLinux)
+	recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "wrong"}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	store.impersonations = append(store.impersonations, db.Impersonation{
+		ID:             uuid.New(),
+		AdminUsername:  "shaw",
+		TargetUsername: "alice",
+		Reason:         "support ticket",
+		CreatedAt:      time.Now(),
+	})
+
+	recorder = serveJSON(t, server, http.MethodGet, "/me/export", nil, alice.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `attachment; filename="alice-export.json"`, recorder.Header().Get("Content-Disposition"))
+	// secrets stay out of the archive
+	require.NotContains(t, recorder.Body.String(), store.users["alice"].Password)
+	require.NotContains(t, recorder.Body.String(), alice.RefreshToken)
+
+	var export accountExport
+	decodeJSON(t, recorder, &export)
+	require.Equal(t, "alice", export.Profile.Username)
+	require.Equal(t, "alice@example.com", export.Profile.Email)
+	require.Len(t, export.Sessions, 2)
+	require.Equal(t, alice.SessionID, export.Sessions[0].ID)
+	require.True(t, export.Sessions[0].Current)
+	require.Len(t, export.LoginHistory, 3)
+	require.False(t, export.LoginHistory[0].Success)
+	require.Len(t, export.Impersonations, 1)
+	require.Equal(t, "support ticket", export.Impersonations[0].Reason)
+}
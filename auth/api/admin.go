@@ -0,0 +1,258 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+type rotateKeysResponse struct {
+	ActiveKeyID string `json:"active_kid"`
+}
+
+// rotateKeys reloads the token keys from the config file and environment
+func (server *Server) rotateKeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageKeys) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can rotate keys")))
+		return
+	}
+	config, err := utils.ReloadConfig()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.RotateKeys(config)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	rsp := rotateKeysResponse{
+		ActiveKeyID: server.tokenMaker.(token.KeyRotator).ActiveKeyID(),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeUserTokensRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+}
+
+// revokeUserTokens invalidates every access and refresh token issued to a user
+// so far, along with their API keys
+func (server *Server) revokeUserTokens(ctx *gin.Context) {
+	var req revokeUserTokensRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageUsers) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can revoke tokens")))
+		return
+	}
+	err := server.endUserSessions(ctx, req.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.revocations.RevokeUser(ctx, req.Username, server.maxTokenLifetime())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.store.RevokeUserApiKeys(ctx, req.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, req.Username)
+}
+
+type createClientRequest struct {
+	ClientID     string   `json:"client_id" binding:"required,alphanum"`
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	RedirectURIs []string `json:"redirect_uris" binding:"dive,url"`
+}
+
+type createClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+	Name         string    `json:"name"`
+	Scopes       []string  `json:"scopes"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// createClient registers a service for the client_credentials grant, or an
+// application users sign in to with OpenID Connect when it is granted the
+// openid scope. The secret is only returned here, the database keeps its hash.
+func (server *Server) createClient(ctx *gin.Context) {
+	var req createClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageClients) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can register clients")))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(clientScopes, scope) && !slices.Contains(oidcScopes, scope) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("scope %s cannot be granted", scope)))
+			return
+		}
+	}
+	if slices.Contains(req.Scopes, token.ScopeOpenID) && len(req.RedirectURIs) == 0 {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("applications using OpenID Connect need a redirect URI")))
+		return
+	}
+	if req.RedirectURIs == nil {
+		req.RedirectURIs = []string{}
+	}
+	secret, err := randomSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	client, err := server.store.CreateClient(ctx, db.CreateClientParams{
+		ClientID:         req.ClientID,
+		ClientSecretHash: hashToken(secret),
+		Scopes:           req.Scopes,
+		Name:             req.Name,
+		RedirectUris:     req.RedirectURIs,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(errors.New("client ID already taken.")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := createClientResponse{
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		RedirectURIs: client.RedirectUris,
+		CreatedAt:    client.CreatedAt,
+	}
+	ctx.JSON(http.StatusCreated, rsp)
+}
+
+type impersonateUserRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+type impersonateUserResponse struct {
+	AccessToken          string       `json:"access_token"`
+	AccessTokenExpiresAt time.Time    `json:"access_token_expires_at"`
+	User                 UserResponse `json:"user"`
+}
+
+// impersonateUser issues a short lived, read only token for another user.
+// The token names the admin in its act claim and every impersonation is audited.
+func (server *Server) impersonateUser(ctx *gin.Context) {
+	var req impersonateUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionImpersonateUsers) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can impersonate users")))
+		return
+	}
+	if req.Username == authPayload.Username {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("cannot impersonate yourself")))
+		return
+	}
+	user, err := server.store.GetUser(ctx, req.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.ImpersonationDuration,
+		token.WithActor(authPayload.Username),
+		token.WithPermissions([]string{}),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.CreateImpersonation(ctx, db.CreateImpersonationParams{
+		ID:             accessPayload.ID,
+		AdminUsername:  authPayload.Username,
+		TargetUsername: user.Username,
+		Reason:         req.Reason,
+		UserAgent:      ctx.Request.UserAgent(),
+		ClientIp:       ctx.ClientIP(),
+		ExpiresAt:      accessPayload.ExpiredAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := impersonateUserResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		User: UserResponse{
+			Name:      user.Name,
+			Username:  user.Username,
+			Role:      user.Role,
+			About:     user.About,
+			Photo:     user.Photo,
+			CreatedAt: user.CreatedAt,
+		},
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type listImpersonationsRequest struct {
+	Username string `form:"username" binding:"required,alphanum"`
+	PageID   int32  `form:"page_id" binding:"required,min=1"`
+	PageSize int32  `form:"page_size" binding:"required,min=5,max=50"`
+}
+
+// listImpersonations returns the audit trail of impersonations of a user
+func (server *Server) listImpersonations(ctx *gin.Context) {
+	var req listImpersonationsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionImpersonateUsers) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can list impersonations")))
+		return
+	}
+	impersonations, err := server.store.ListImpersonations(ctx, db.ListImpersonationsParams{
+		TargetUsername: req.Username,
+		Limit:          req.PageSize,
+		Offset:         (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, impersonations)
+}
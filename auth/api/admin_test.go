@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestRotateKeys(t *testing.T) {
+	server := NewTestServer(t, nil)
+	oldKey := server.config.TokenSymmetricKey
+	oldToken, _, err := server.tokenMaker.CreateToken(utils.RandomString(8), "user", time.Minute)
+	require.NoError(t, err)
+
+	config := server.config
+	config.TokenSymmetricKey = utils.RandomString(32)
+	config.TokenVerificationKeys = []string{oldKey}
+	require.NoError(t, server.RotateKeys(config))
+
+	_, err = server.tokenMaker.VerifyToken(oldToken)
+	require.NoError(t, err)
+
+	config.TokenVerificationKeys = nil
+	require.NoError(t, server.RotateKeys(config))
+
+	_, err = server.tokenMaker.VerifyToken(oldToken)
+	require.EqualError(t, err, token.ErrInvalidToken.Error())
+
+	config.TokenType = "paseto_local"
+	require.Error(t, server.RotateKeys(config))
+}
+
+// impersonationStore records impersonations in memory, the other queries are not implemented
+type impersonationStore struct {
+	db.Store
+	impersonations []db.CreateImpersonationParams
+}
+
+func (store *impersonationStore) GetUser(ctx context.Context, username string) (db.User, error) {
+	return db.User{Username: username, Role: "admin"}, nil
+}
+
+func (store *impersonationStore) CreateImpersonation(ctx context.Context, arg db.CreateImpersonationParams) (db.Impersonation, error) {
+	store.impersonations = append(store.impersonations, arg)
+	return db.Impersonation{ID: arg.ID}, nil
+}
+
+func TestImpersonateUser(t *testing.T) {
+	var forwarded http.Header
+	blog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+	defer blog.Close()
+
+	store := &impersonationStore{}
+	server := NewTestServer(t, store)
+	server.config.BlogMicroURL = blog.URL
+
+	impersonate := func(t *testing.T, role string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := `{"username":"target","reason":"support ticket"}`
+		request, err := http.NewRequest(http.MethodPost, "/admin/impersonate", strings.NewReader(body))
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "support", role, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	require.Equal(t, http.StatusUnauthorized, impersonate(t, "user").Code)
+	require.Empty(t, store.impersonations)
+
+	recorder := impersonate(t, "admin")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp impersonateUserResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+	require.Equal(t, "target", rsp.User.Username)
+
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "target", payload.Username)
+	require.Equal(t, "support", payload.Actor.Username)
+	// the admin role of the target is not passed on to the impersonator
+	require.Empty(t, payload.Permissions)
+
+	require.Len(t, store.impersonations, 1)
+	require.Equal(t, payload.ID, store.impersonations[0].ID)
+	require.Equal(t, "support", store.impersonations[0].AdminUsername)
+	require.Equal(t, "target", store.impersonations[0].TargetUsername)
+	require.Equal(t, "support ticket", store.impersonations[0].Reason)
+
+	send := func(t *testing.T, method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+		request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+rsp.AccessToken)
+		request.Header.Set("X-Impersonator", "spoofed")
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// the blog sees both identities
+	require.Equal(t, http.StatusOK, send(t, http.MethodGet, "/blog/posts").Code)
+	require.Equal(t, "target", forwarded.Get("X-Username"))
+	require.Equal(t, "support", forwarded.Get("X-Impersonator"))
+
+	// impersonation is read only
+	require.Equal(t, http.StatusForbidden, send(t, http.MethodPost, "/blog/posts").Code)
+	require.Equal(t, http.StatusForbidden, send(t, http.MethodPut, "/login").Code)
+}
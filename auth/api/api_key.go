@@ -0,0 +1,234 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+const (
+	// apiKeyPrefix makes our keys easy to spot in scripts and secret scanners
+	apiKeyPrefix = "ak_"
+	// apiKeyLastUsedResolution limits how often using a key writes to the database
+	apiKeyLastUsedResolution = time.Minute
+)
+
+var (
+	errInvalidApiKey = errors.New("API key is invalid")
+	errExpiredApiKey = errors.New("API key has expired")
+)
+
+type createApiKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createApiKeyResponse struct {
+	ApiKey string `json:"api_key"`
+	apiKeyResponse
+}
+
+func newApiKeyResponse(apiKey db.ApiKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  nullTime(apiKey.ExpiresAt),
+		LastUsedAt: nullTime(apiKey.LastUsedAt),
+		RevokedAt:  nullTime(apiKey.RevokedAt),
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// apiKeyScopes lists the scopes a user with role can grant to an API key
+func apiKeyScopes(role string) []string {
+	return append([]string{token.ScopeWriteBlog, token.ScopeWriteProfile}, token.PermissionsForRole(role)...)
+}
+
+// randomSecret returns 32 random bytes encoded for use in headers and URLs
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashToken is how API keys, client secrets and one-time tokens are stored.
+// They are random enough that a fast hash does not make them guessable.
+func hashToken(rawToken string) string {
+	hash := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// createApiKey issues a new API key for the user. The key itself is only
+// returned here, the database keeps its hash.
+func (server *Server) createApiKey(ctx *gin.Context) {
+	var req createApiKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	allowed := apiKeyScopes(authPayload.Role)
+	for _, scope := range req.Scopes {
+		if !slices.Contains(allowed, scope) {
+			ctx.JSON(http.StatusForbidden, errorResponse(fmt.Errorf("scope %s cannot be granted", scope)))
+			return
+		}
+	}
+	var expiresAt sql.NullTime
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("expires_at must be in the future")))
+			return
+		}
+		expiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rawKey := apiKeyPrefix + secret
+	arg := db.CreateApiKeyParams{
+		ID:        uuid.New(),
+		Username:  authPayload.Username,
+		Name:      req.Name,
+		KeyHash:   hashToken(rawKey),
+		Scopes:    req.Scopes,
+		ExpiresAt: expiresAt,
+	}
+	apiKey, err := server.store.CreateApiKey(ctx, arg)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(errors.New("API key name already taken.")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := createApiKeyResponse{
+		ApiKey:         rawKey,
+		apiKeyResponse: newApiKeyResponse(apiKey),
+	}
+	ctx.JSON(http.StatusCreated, rsp)
+}
+
+func (server *Server) listApiKeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	apiKeys, err := server.store.ListApiKeys(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := make([]apiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		rsp = append(rsp, newApiKeyResponse(apiKey))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeApiKeyRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+func (server *Server) revokeApiKey(ctx *gin.Context) {
+	var req revokeApiKeyRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	apiKey, err := server.store.RevokeApiKey(ctx, db.RevokeApiKeyParams{
+		ID:       uuid.MustParse(req.ID),
+		Username: authPayload.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newApiKeyResponse(apiKey))
+}
+
+// verifyApiKey looks up the key presented with the ApiKey authorization type.
+// The payload carries the scopes of the key that the role of its owner still grants.
+func (server *Server) verifyApiKey(ctx *gin.Context, rawKey string) (*token.Payload, error) {
+	apiKey, err := server.store.GetApiKeyByHash(ctx, hashToken(rawKey))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidApiKey
+		}
+		return nil, err
+	}
+	if apiKey.RevokedAt.Valid {
+		return nil, errInvalidApiKey
+	}
+	if apiKey.ExpiresAt.Valid && time.Now().After(apiKey.ExpiresAt.Time) {
+		return nil, errExpiredApiKey
+	}
+	user, err := server.store.GetUser(ctx, apiKey.Username)
+	if err != nil {
+		return nil, err
+	}
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) > apiKeyLastUsedResolution {
+		if err := server.store.UpdateApiKeyLastUsed(ctx, apiKey.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed := apiKeyScopes(user.Role)
+	permissions := []string{}
+	for _, scope := range apiKey.Scopes {
+		if slices.Contains(allowed, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	payload := &token.Payload{
+		ID:           apiKey.ID,
+		Username:     apiKey.Username,
+		SubjectType:  token.SubjectTypeUser,
+		Role:         user.Role,
+		Permissions:  permissions,
+		IssuedAt:     apiKey.CreatedAt,
+		ExpiredAt:    apiKey.ExpiresAt.Time,
+		NeverExpires: !apiKey.ExpiresAt.Valid,
+	}
+	return payload, nil
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// apiKeyStore keeps API keys in memory, the other queries are not implemented
+type apiKeyStore struct {
+	db.Store
+	apiKeys map[uuid.UUID]db.ApiKey
+}
+
+func newApiKeyStore() *apiKeyStore {
+	return &apiKeyStore{apiKeys: make(map[uuid.UUID]db.ApiKey)}
+}
+
+func (store *apiKeyStore) CreateApiKey(ctx context.Context, arg db.CreateApiKeyParams) (db.ApiKey, error) {
+	apiKey := db.ApiKey{
+		ID:        arg.ID,
+		Username:  arg.Username,
+		Name:      arg.Name,
+		KeyHash:   arg.KeyHash,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	store.apiKeys[apiKey.ID] = apiKey
+	return apiKey, nil
+}
+
+func (store *apiKeyStore) GetApiKeyByHash(ctx context.Context, keyHash string) (db.ApiKey, error) {
+	for _, apiKey := range store.apiKeys {
+		if apiKey.KeyHash == keyHash {
+			return apiKey, nil
+		}
+	}
+	return db.ApiKey{}, sql.ErrNoRows
+}
+
+func (store *apiKeyStore) RevokeApiKey(ctx context.Context, arg db.RevokeApiKeyParams) (db.ApiKey, error) {
+	apiKey, ok := store.apiKeys[arg.ID]
+	if !ok || apiKey.Username != arg.Username || apiKey.RevokedAt.Valid {
+		return db.ApiKey{}, sql.ErrNoRows
+	}
+	apiKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.apiKeys[arg.ID] = apiKey
+	return apiKey, nil
+}
+
+func (store *apiKeyStore) UpdateApiKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+	apiKey := store.apiKeys[id]
+	apiKey.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.apiKeys[id] = apiKey
+	return nil
+}
+
+func (store *apiKeyStore) GetUser(ctx context.Context, username string) (db.User, error) {
+	return db.User{Username: username, Role: "user"}, nil
+}
+
+func TestApiKeyAuthorization(t *testing.T) {
+	store := newApiKeyStore()
+	server := NewTestServer(t, store)
+
+	server.router.GET(
+		"/scoped",
+		authMiddleware(server.tokenMaker, server.revocations, server.verifyApiKey, nil),
+		requireScope(token.ScopeWriteBlog),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	createApiKey := func(t *testing.T, body gin.H) createApiKeyResponse {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/api-keys", bytes.NewReader(data))
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", "user", time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+
+		var rsp createApiKeyResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+		require.NotEmpty(t, rsp.ApiKey)
+		require.Nil(t, rsp.LastUsedAt)
+		return rsp
+	}
+	call := func(t *testing.T, method string, path string, apiKey string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+		request.Header.Set(authorizationHeaderKey, fmt.Sprintf("ApiKey %s", apiKey))
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	blogKey := createApiKey(t, gin.H{"name": "blog", "scopes": []string{token.ScopeWriteBlog}})
+	profileKey := createApiKey(t, gin.H{"name": "profile", "scopes": []string{token.ScopeWriteProfile}})
+	expiringKey := createApiKey(t, gin.H{
+		"name":       "expiring",
+		"scopes":     []string{token.ScopeWriteBlog},
+		"expires_at": time.Now().Add(time.Minute),
+	})
+
+	require.Equal(t, http.StatusOK, call(t, http.MethodGet, "/scoped", blogKey.ApiKey).Code)
+	require.True(t, store.apiKeys[blogKey.ID].LastUsedAt.Valid)
+
+	// keys without an expiry say so instead of expiring at the zero time
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	payload, err := server.verifyApiKey(ctx, blogKey.ApiKey)
+	require.NoError(t, err)
+	require.True(t, payload.NeverExpires)
+	require.NoError(t, payload.Valid())
+	payload, err = server.verifyApiKey(ctx, expiringKey.ApiKey)
+	require.NoError(t, err)
+	require.False(t, payload.NeverExpires)
+	require.WithinDuration(t, time.Now().Add(time.Minute), payload.ExpiredAt, time.Second)
+	require.Equal(t, http.StatusForbidden, call(t, http.MethodGet, "/scoped", profileKey.ApiKey).Code)
+	require.Equal(t, http.StatusUnauthorized, call(t, http.MethodGet, "/scoped", "ak_unknown").Code)
+
+	// API keys cannot manage API keys
+	require.Equal(t, http.StatusUnauthorized, call(t, http.MethodGet, "/api-keys", blogKey.ApiKey).Code)
+
+	expired := store.apiKeys[expiringKey.ID]
+	expired.ExpiresAt.Time = time.Now().Add(-time.Second)
+	store.apiKeys[expiringKey.ID] = expired
+	require.Equal(t, http.StatusUnauthorized, call(t, http.MethodGet, "/scoped", expiringKey.ApiKey).Code)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodDelete, "/api-keys/"+blogKey.ID.String(), nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", "user", time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusUnauthorized, call(t, http.MethodGet, "/scoped", blogKey.ApiKey).Code)
+}
+
+func TestCreateApiKeyScopes(t *testing.T) {
+	server := NewTestServer(t, newApiKeyStore())
+
+	body, err := json.Marshal(gin.H{"name": "admin", "scopes": []string{token.PermissionManageUsers}})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api-keys", bytes.NewReader(body))
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", "user", time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
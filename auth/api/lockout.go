@@ -0,0 +1,175 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// Failed logins are counted against both the username and the client IP, so
+// neither guessing one password nor spraying many usernames goes unnoticed
+const (
+	loginKindUsername = "username"
+	loginKindIP       = "ip"
+	// loginBackoff is the first lockout once the limit is reached, each
+	// further failure doubles it up to LOGIN_LOCKOUT_DURATION
+	loginBackoff = 30 * time.Second
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid username or password")
+	errLoginLocked        = errors.New("too many failed login attempts, try again later")
+	errWrongPassword      = errors.New("current password is incorrect")
+)
+
+// loginLockout returns how long to lock out after failures in a row, 0 while
+// the limit is not reached. A limit of 0 disables the lockout.
+func loginLockout(failures int32, maxAttempts int, maxLockout time.Duration) time.Duration {
+	if maxAttempts <= 0 || int(failures) < maxAttempts {
+		return 0
+	}
+	lockout := loginBackoff
+	for i := maxAttempts; i < int(failures) && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, maxLockout)
+}
+
+// loginKeys are the principals a login attempt of the request counts against
+func loginKeys(ctx *gin.Context, username string) []db.GetLoginAttemptParams {
+	return []db.GetLoginAttemptParams{
+		{Kind: loginKindUsername, Identifier: username},
+		{Kind: loginKindIP, Identifier: ctx.ClientIP()},
+	}
+}
+
+func (server *Server) loginMaxAttempts(kind string) int {
+	if kind == loginKindIP {
+		return server.config.LoginIPMaxAttempts
+	}
+	return server.config.LoginMaxAttempts
+}
+
+// loginLockedFor returns how long the username, or the client IP of the
+// request, stays locked out
+func (server *Server) loginLockedFor(ctx *gin.Context, username string) (time.Duration, error) {
+	var lockedFor time.Duration
+	for _, key := range loginKeys(ctx, username) {
+		attempt, err := server.store.GetLoginAttempt(ctx, key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return 0, err
+		}
+		if attempt.LockedUntil.Valid {
+			lockedFor = max(lockedFor, time.Until(attempt.LockedUntil.Time))
+		}
+	}
+	return lockedFor, nil
+}
+
+// rejectLockedLogin tells the client when it may try again
+func rejectLockedLogin(ctx *gin.Context, lockedFor time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, errorResponse(errLoginLocked))
+}
+
+// recordLoginFailure counts a failed login against the username and the
+// client IP of the request, locking them out once they reach their limit.
+// Failures older than LOGIN_LOCKOUT_DURATION are forgotten.
+func (server *Server) recordLoginFailure(ctx *gin.Context, username string) error {
+	resetBefore := time.Now().Add(-server.config.LoginLockoutDuration)
+	err := server.store.DeleteExpiredLoginAttempts(ctx, resetBefore)
+	if err != nil {
+		return err
+	}
+	for _, key := range loginKeys(ctx, username) {
+		attempt, err := server.store.RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+			Kind:        key.Kind,
+			Identifier:  key.Identifier,
+			ResetBefore: resetBefore,
+		})
+		if err != nil {
+			return err
+		}
+		lockout := loginLockout(attempt.Failures, server.loginMaxAttempts(key.Kind), server.config.LoginLockoutDuration)
+		if lockout == 0 {
+			continue
+		}
+		err = server.store.LockLogin(ctx, db.LockLoginParams{
+			Kind:        key.Kind,
+			Identifier:  key.Identifier,
+			LockedUntil: sql.NullTime{Time: time.Now().Add(lockout), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confirmPassword checks the password a signed in user gives to confirm a
+// sensitive change, it answers the request when the check fails. Wrong
+// passwords count like failed logins, a stolen token must not be a way
+// around the login lockout.
+func (server *Server) confirmPassword(ctx *gin.Context, user db.User, password string) bool {
+	lockedFor, err := server.loginLockedFor(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return false
+	}
+	if err := server.passwordHasher.Check(password, user.Password); err != nil {
+		if err := server.recordLoginFailure(ctx, user.Username); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return false
+		}
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errWrongPassword))
+		return false
+	}
+	return true
+}
+
+type unlockLoginRequest struct {
+	Username string `json:"username" binding:"required_without=IP,omitempty,alphanum"`
+	IP       string `json:"ip" binding:"required_without=Username,omitempty,ip"`
+}
+
+// unlockLogin lifts the lockout of a username or an IP and forgets their failed logins
+func (server *Server) unlockLogin(ctx *gin.Context) {
+	var req unlockLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageUsers) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can unlock logins")))
+		return
+	}
+	keys := []db.DeleteLoginAttemptParams{
+		{Kind: loginKindUsername, Identifier: req.Username},
+		{Kind: loginKindIP, Identifier: req.IP},
+	}
+	for _, key := range keys {
+		if key.Identifier == "" {
+			continue
+		}
+		if err := server.store.DeleteLoginAttempt(ctx, key); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, req)
+}
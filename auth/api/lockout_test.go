@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestLoginLockoutDuration(t *testing.T) {
+	require.Zero(t, loginLockout(2, 3, time.Hour))
+	require.Equal(t, loginBackoff, loginLockout(3, 3, time.Hour))
+	require.Equal(t, 2*loginBackoff, loginLockout(4, 3, time.Hour))
+	require.Equal(t, 8*loginBackoff, loginLockout(6, 3, time.Hour))
+	require.Equal(t, time.Hour, loginLockout(100, 3, time.Hour))
+	require.Zero(t, loginLockout(100, 0, time.Hour))
+}
+
+func TestLoginUserLockout(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	login := func(username string, password string) int {
+		recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": username, "password": password}, "")
+		return recorder.Code
+	}
+
+	// unknown users cannot be told apart from wrong passwords
+	unknown := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "nobody", "password": "secret"}, "")
+	wrong := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "wrong"}, "")
+	require.Equal(t, http.StatusUnauthorized, unknown.Code)
+	require.Equal(t, unknown.Code, wrong.Code)
+	require.Equal(t, unknown.Body.String(), wrong.Body.String())
+
+	require.Equal(t, http.StatusUnauthorized, login("alice", "wrong"))
+	require.Equal(t, http.StatusUnauthorized, login("alice", "wrong"))
+	recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "secret"}, "")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, fmt.Sprint(loginBackoff.Seconds()), recorder.Header().Get("Retry-After"))
+	// other users are not affected
+	require.Equal(t, http.StatusUnauthorized, login("bob", "wrong"))
+
+	adminToken, _, err := server.tokenMaker.CreateToken("admin", "admin", time.Minute)
+	require.NoError(t, err)
+	userToken, _, err := server.tokenMaker.CreateToken("bob", "user", time.Minute)
+	require.NoError(t, err)
+	recorder = serveJSON(t, server, http.MethodPost, "/admin/unlock", gin.H{"username": "alice"}, userToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/admin/unlock", gin.H{}, adminToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/admin/unlock", gin.H{"username": "alice"}, adminToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// signing in forgets the failures
+	require.Equal(t, http.StatusOK, login("alice", "secret"))
+	require.Equal(t, http.StatusUnauthorized, login("alice", "wrong"))
+	require.Equal(t, http.StatusUnauthorized, login("alice", "wrong"))
+	require.Equal(t, http.StatusOK, login("alice", "secret"))
+}
+
+// loginFrom signs in from the client at remoteAddr
+func loginFrom(t *testing.T, server *Server, remoteAddr string, username string) int {
+	body, err := json.Marshal(gin.H{"username": username, "password": "secret"})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	request.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+
+	// spraying a password over many usernames locks out the client
+	for i := 0; i < server.config.LoginIPMaxAttempts; i++ {
+		require.Equal(t, http.StatusUnauthorized, loginFrom(t, server, "192.0.2.1:1234", utils.RandomString(8)))
+	}
+	require.Equal(t, http.StatusTooManyRequests, loginFrom(t, server, "192.0.2.1:1234", "alice"))
+	require.Equal(t, http.StatusOK, loginFrom(t, server, "192.0.2.2:1234", "alice"))
+
+	adminToken, _, err := server.tokenMaker.CreateToken("admin", "admin", time.Minute)
+	require.NoError(t, err)
+	recorder := serveJSON(t, server, http.MethodPost, "/admin/unlock", gin.H{"ip": "192.0.2.1"}, adminToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusOK, loginFrom(t, server, "192.0.2.1:1234", "alice"))
+}
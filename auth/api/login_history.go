@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// recordLogin adds a sign in attempt of user from the client of the request
+// to their login history. Users are emailed when they sign in from a device
+// or an IP they never signed in from before.
+func (server *Server) recordLogin(ctx *gin.Context, user db.User, success bool) error {
+	userAgent := ctx.Request.UserAgent()
+	// the device is a coarse fingerprint, browser updates do not make it new
+	device := deviceName(userAgent)
+	var known db.GetKnownLoginSourcesRow
+	if success {
+		var err error
+		known, err = server.store.GetKnownLoginSources(ctx, db.GetKnownLoginSourcesParams{
+			Device:   device,
+			ClientIp: ctx.ClientIP(),
+			Username: user.Username,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	event, err := server.store.CreateLoginEvent(ctx, db.CreateLoginEventParams{
+		Username:  user.Username,
+		Success:   success,
+		ClientIp:  ctx.ClientIP(),
+		UserAgent: userAgent,
+		Device:    device,
+	})
+	if err != nil {
+		return err
+	}
+	// the first sign in of an account is not news to anyone
+	if !success || known.Logins == 0 || (known.KnownDevice && known.KnownIp) || !user.Email.Valid {
+		return nil
+	}
+	err = server.notifier.Notify(ctx, notify.Message{
+		Type:  notify.TypeNewSignIn,
+		Email: user.Email.String,
+		Summary: fmt.Sprintf(
+			"Your account %s was signed in to from %s at IP address %s on %s.",
+			user.Username, event.Device, event.ClientIp, event.CreatedAt.UTC().Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		// the sign in went through, only the alert is lost
+		log.Print("Can't send new sign in email: ", err)
+	}
+	return nil
+}
+
+type listLoginHistoryRequest struct {
+	PageID   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=5,max=50"`
+}
+
+// listLoginHistory shows the caller their sign in attempts, most recent first
+func (server *Server) listLoginHistory(ctx *gin.Context) {
+	var req listLoginHistoryRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	events, err := server.store.ListLoginEvents(ctx, db.ListLoginEventsParams{
+		Username: authPayload.Username,
+		Limit:    req.PageSize,
+		Offset:   (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func TestLoginHistory(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+
+	signIn := func(username string, password string, userAgent string, remoteAddr string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(gin.H{"username": username, "password": password})
+		require.NoError(t, err)
+		request := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		request.Header.Set("User-Agent", userAgent)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	alerts := func() []notify.Message {
+		var alerts []notify.Message
+		for _, msg := range notifier.messages {
+			if msg.Type == notify.TypeNewSignIn {
+				alerts = append(alerts, msg)
+			}
+		}
+		return alerts
+	}
+
+	// the first sign in of an account is not alerted
+	require.Equal(t, http.StatusOK, signIn("alice", "secret", firefoxLinux, "192.0.2.1:1234").Code)
+	require.Equal(t, http.StatusUnauthorized, signIn("alice", "wrong", safariIPhone, "192.0.2.9:1234").Code)
+	require.Equal(t, http.StatusOK, signIn("alice", "secret", firefoxLinux, "192.0.2.1:4321").Code)
+	require.Empty(t, alerts())
+
+	// a new device on a known network
+	require.Equal(t, http.StatusOK, signIn("alice", "secret", safariIPhone, "192.0.2.1:1234").Code)
+	require.Len(t, alerts(), 1)
+	require.Equal(t, "alice@example.com", alerts()[0].Email)
+	require.Contains(t, alerts()[0].Summary, "Safari on iOS")
+	// a known device on a new network
+	require.Equal(t, http.StatusOK, signIn("alice", "secret", firefoxLinux, "198.51.100.7:1234").Code)
+	require.Len(t, alerts(), 2)
+	require.Contains(t, alerts()[1].Summary, "198.51.100.7")
+	require.Equal(t, http.StatusOK, signIn("alice", "secret", safariIPhone, "198.51.100.7:1234").Code)
+	require.Len(t, alerts(), 2)
+
+	var session loginUserResponse
+	decodeJSON(t, signIn("alice", "secret", firefoxLinux, "192.0.2.1:1234"), &session)
+	recorder := serveJSON(t, server, http.MethodGet, "/me/logins?page_id=1&page_size=5", nil, session.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var events []db.LoginEvent
+	decodeJSON(t, recorder, &events)
+	require.Len(t, events, 5)
+	require.Equal(t, "Firefox on Linux", events[0].Device)
+	require.Equal(t, firefoxLinux, events[0].UserAgent)
+	require.True(t, events[0].Success)
+
+	recorder = serveJSON(t, server, http.MethodGet, "/me/logins?page_id=2&page_size=5", nil, session.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &events)
+	require.Len(t, events, 2)
+	require.False(t, events[0].Success)
+	require.Equal(t, "192.0.2.9", events[0].ClientIp)
+
+	recorder = serveJSON(t, server, http.MethodGet, "/me/logins", nil, session.AccessToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// users only see their own history
+	bob := loginWithUserAgent(t, server, "bob", edgeWindows)
+	recorder = serveJSON(t, server, http.MethodGet, "/me/logins?page_id=1&page_size=5", nil, bob.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &events)
+	require.Len(t, events, 1)
+	require.Equal(t, "bob", events[0].Username)
+}
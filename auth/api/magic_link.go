@@ -0,0 +1,132 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+var errInvalidMagicLink = errors.New("sign in link is invalid or has expired")
+
+type sendMagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// sendMagicLink mails a link that signs the owner of an address in without
+// a password. Like forgotPassword, it answers the same whether or not the
+// address is registered.
+func (server *Server) sendMagicLink(ctx *gin.Context) {
+	var req sendMagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, err := server.store.GetUserByEmail(ctx, sql.NullString{String: req.Email, Valid: true})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusAccepted, gin.H{})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.sendMagicLinkEmail(ctx, user)
+	if err != nil {
+		// failing here would tell the caller that the address is registered
+		log.Print("Can't send magic link email: ", err)
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
+
+// sendMagicLinkEmail mails user a link that works once
+func (server *Server) sendMagicLinkEmail(ctx *gin.Context, user db.User) error {
+	linkToken, err := server.createUserToken(ctx, user.Username, userTokenMagicLink, user.Email.String, server.config.MagicLinkDuration)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/login/magic-link/verify?token=%s", server.config.PublicURL, url.QueryEscape(linkToken))
+	return server.notifier.Notify(ctx, notify.Message{
+		Type:    notify.TypeMagicLink,
+		Email:   user.Email.String,
+		Links:   []string{link},
+		Summary: fmt.Sprintf("Open the link below to sign in to your account %s.", user.Username),
+	})
+}
+
+type verifyMagicLinkRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+// verifyMagicLink signs the user in with a link from sendMagicLink. The link
+// stands in for the password, users with two-factor authentication still
+// have to give a code.
+func (server *Server) verifyMagicLink(ctx *gin.Context) {
+	var req verifyMagicLinkRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	tokenParams := db.GetUserTokenParams{
+		TokenHash: hashToken(req.Token),
+		Purpose:   userTokenMagicLink,
+	}
+	userToken, err := server.store.GetUserToken(ctx, tokenParams)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	lockedFor, err := server.loginLockedFor(ctx, userToken.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return
+	}
+	user, err := server.store.GetUser(ctx, userToken.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the link only proves access to the address it was sent to
+	if user.Email != userToken.Email {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+		return
+	}
+	// each link signs in at most once, however many requests race to use it
+	_, err = server.store.UseUserToken(ctx, db.UseUserTokenParams(tokenParams))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.TotpEnabled || user.MfaRequired {
+		server.startMFALogin(ctx, user)
+		return
+	}
+	rsp, err := server.createSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if err := server.recordLogin(ctx, user, true); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+
+	verify := func(linkToken string) (int, loginUserResponse) {
+		recorder := serveJSON(t, server, http.MethodGet, "/login/magic-link/verify?token="+url.QueryEscape(linkToken), nil, "")
+		var rsp loginUserResponse
+		if recorder.Code == http.StatusOK {
+			decodeJSON(t, recorder, &rsp)
+		}
+		return recorder.Code, rsp
+	}
+
+	// unknown addresses get the same answer but no email
+	sent := len(notifier.messages)
+	recorder := serveJSON(t, server, http.MethodPost, "/login/magic-link", gin.H{"email": "nobody@example.com"}, "")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Len(t, notifier.messages, sent)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login/magic-link", gin.H{"email": "not-an-email"}, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login/magic-link", gin.H{"email": "alice@example.com"}, "")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Len(t, notifier.messages, sent+1)
+	require.Equal(t, notify.TypeMagicLink, notifier.messages[sent].Type)
+	linkToken := lastLinkToken(t, server, "alice@example.com")
+
+	// the link is not an access token
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, linkToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	code, rsp := verify(linkToken)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "alice", rsp.User.Username)
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, rsp.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, store.loginEvents, 1)
+	require.True(t, store.loginEvents[0].Success)
+
+	// links work once
+	code, _ = verify(linkToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	// concurrent clicks on one link sign in once
+	recorder = serveJSON(t, server, http.MethodPost, "/login/magic-link", gin.H{"email": "alice@example.com"}, "")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	linkToken = lastLinkToken(t, server, "alice@example.com")
+	codes := make(chan int, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/login/magic-link/verify?token="+url.QueryEscape(linkToken), nil)
+			server.router.ServeHTTP(recorder, request)
+			codes <- recorder.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	require.Equal(t, 1, succeeded)
+
+	// other tokens are not sign in links
+	code, _ = verify(rsp.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+	verificationLink, err := url.Parse(notifier.messages[0].Links[0])
+	require.NoError(t, err)
+	code, _ = verify(verificationLink.Query().Get("token"))
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = verify("invalid")
+	require.Equal(t, http.StatusUnauthorized, code)
+}
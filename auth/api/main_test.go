@@ -1,26 +1,72 @@
 package api
 
 import (
+	"context"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
 	"shivesh-ranjan.github.io/m/utils"
 )
 
 func NewTestServer(t *testing.T, store db.Store) *Server {
-	config := utils.Config{
-		TokenSymmetricKey:   utils.RandomString(32),
-		AccessTokenDuration: time.Minute,
-	}
-	server, err := NewServer(config, store)
+	server, err := NewServer(testConfig(), store, &testNotifier{})
 	require.NoError(t, err)
 	return server
 }
 
+func testConfig() utils.Config {
+	return utils.Config{
+		TokenSymmetricKey:          utils.RandomString(32),
+		TokenIssuer:                "auth",
+		TokenAudience:              "gateway",
+		TokenExchangeAudiences:     []string{"blog"},
+		AccessTokenDuration:        time.Minute,
+		RefreshTokenDuration:       time.Hour,
+		ServiceTokenDuration:       time.Minute,
+		ImpersonationDuration:      time.Minute,
+		EmailVerificationDuration:  time.Minute,
+		PasswordResetDuration:      time.Minute,
+		MFATokenDuration:           time.Minute,
+		MagicLinkDuration:          time.Minute,
+		AccountDeletionGracePeriod: time.Hour,
+		UsernameReservationPeriod:  time.Hour,
+		OIDCLoginDuration:          time.Minute,
+		LoginMaxAttempts:           3,
+		LoginIPMaxAttempts:         10,
+		LoginLockoutDuration:       time.Hour,
+		// cheap hashes keep the tests fast
+		PasswordArgon2Time:   1,
+		PasswordArgon2Memory: 1024,
+	}
+}
+
+// testNotifier records the messages sent and the events published by the server
+type testNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+	events   []notify.Event
+}
+
+func (notifier *testNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.messages = append(notifier.messages, msg)
+	return nil
+}
+
+func (notifier *testNotifier) Publish(ctx context.Context, event notify.Event) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.events = append(notifier.events, event)
+	return nil
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	os.Exit(m.Run())
@@ -0,0 +1,843 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+)
+
+// memoryStore keeps users and what hangs off them, like one-time tokens,
+// sessions, linked identities, failed logins, the applications they signed
+// in to, pending deletions and old usernames, in memory for the account flows.
+// The other queries are not implemented.
+type memoryStore struct {
+	db.Store
+
+	mu             sync.Mutex
+	users          map[string]db.User
+	userTokens     map[string]db.UserToken
+	sessions       map[uuid.UUID]db.Session
+	recoveryCodes  map[string]db.RecoveryCode
+	oidcLogins     map[string]db.OidcLogin
+	identities     map[string]db.UserIdentity
+	clients        map[string]db.Client
+	consents       map[string]db.Consent
+	authCodes      map[string]db.AuthorizationCode
+	loginAttempts  map[string]db.LoginAttempt
+	loginEvents    []db.LoginEvent
+	impersonations []db.Impersonation
+	deletions      map[string]db.AccountDeletion
+	renames        []db.UsernameChange
+	// apiKeysRevoked lists the users whose API keys were revoked, the keys are not kept
+	apiKeysRevoked []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:         make(map[string]db.User),
+		userTokens:    make(map[string]db.UserToken),
+		sessions:      make(map[uuid.UUID]db.Session),
+		recoveryCodes: make(map[string]db.RecoveryCode),
+		oidcLogins:    make(map[string]db.OidcLogin),
+		identities:    make(map[string]db.UserIdentity),
+		clients:       make(map[string]db.Client),
+		consents:      make(map[string]db.Consent),
+		authCodes:     make(map[string]db.AuthorizationCode),
+		loginAttempts: make(map[string]db.LoginAttempt),
+		deletions:     make(map[string]db.AccountDeletion),
+	}
+}
+
+func (store *memoryStore) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.users[arg.Username]; ok {
+		return db.User{}, &pq.Error{Code: "23505", Constraint: "users_pkey"}
+	}
+	for _, user := range store.users {
+		if arg.Email.Valid && user.Email == arg.Email {
+			return db.User{}, &pq.Error{Code: "23505", Constraint: "users_email_key"}
+		}
+	}
+	user := db.User{
+		ID:        uuid.New(),
+		Username:  arg.Username,
+		Name:      arg.Name,
+		Password:  arg.Password,
+		About:     arg.About,
+		Photo:     arg.Photo,
+		Role:      arg.Role,
+		CreatedAt: time.Now(),
+		Email:     arg.Email,
+	}
+	store.users[user.Username] = user
+	return user, nil
+}
+
+func (store *memoryStore) GetUser(ctx context.Context, username string) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (store *memoryStore) VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[arg.Username]
+	if !ok || user.Email != arg.Email {
+		return db.User{}, sql.ErrNoRows
+	}
+	user.EmailVerified = true
+	store.users[user.Username] = user
+	return user, nil
+}
+
+func (store *memoryStore) CreateUserToken(ctx context.Context, arg db.CreateUserTokenParams) (db.UserToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	userToken := db.UserToken{
+		TokenHash: arg.TokenHash,
+		Username:  arg.Username,
+		Purpose:   arg.Purpose,
+		Email:     arg.Email,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	store.userTokens[userToken.TokenHash] = userToken
+	return userToken, nil
+}
+
+func (store *memoryStore) GetUserToken(ctx context.Context, arg db.GetUserTokenParams) (db.UserToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	userToken, ok := store.userTokens[arg.TokenHash]
+	if !ok || userToken.Purpose != arg.Purpose || userToken.UsedAt.Valid || !userToken.ExpiresAt.After(time.Now()) {
+		return db.UserToken{}, sql.ErrNoRows
+	}
+	return userToken, nil
+}
+
+func (store *memoryStore) UseUserToken(ctx context.Context, arg db.UseUserTokenParams) (db.UserToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	userToken, ok := store.userTokens[arg.TokenHash]
+	if !ok || userToken.Purpose != arg.Purpose || userToken.UsedAt.Valid || !userToken.ExpiresAt.After(time.Now()) {
+		return db.UserToken{}, sql.ErrNoRows
+	}
+	userToken.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.userTokens[arg.TokenHash] = userToken
+	return userToken, nil
+}
+
+func (store *memoryStore) GetUserByEmail(ctx context.Context, email sql.NullString) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, user := range store.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return db.User{}, sql.ErrNoRows
+}
+
+func (store *memoryStore) UpdatePassword(ctx context.Context, arg db.UpdatePasswordParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[arg.Username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	user.Password = arg.Password
+	store.users[user.Username] = user
+	return user, nil
+}
+
+func (store *memoryStore) RehashPassword(ctx context.Context, arg db.RehashPasswordParams) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[arg.Username]
+	if ok && user.Password == arg.OldPassword {
+		user.Password = arg.NewPassword
+		store.users[user.Username] = user
+	}
+	return nil
+}
+
+func (store *memoryStore) CreateSession(ctx context.Context, arg db.CreateSessionParams) (db.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	session := db.Session{
+		ID:           arg.ID,
+		Username:     arg.Username,
+		RefreshToken: arg.RefreshToken,
+		UserAgent:    arg.UserAgent,
+		ClientIp:     arg.ClientIp,
+		IsBlocked:    arg.IsBlocked,
+		ExpiresAt:    arg.ExpiresAt,
+		CreatedAt:    time.Now(),
+		LastSeenAt:   time.Now(),
+	}
+	store.sessions[session.ID] = session
+	return session, nil
+}
+
+func (store *memoryStore) GetSession(ctx context.Context, id uuid.UUID) (db.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	session, ok := store.sessions[id]
+	if !ok {
+		return db.Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (store *memoryStore) ListUserSessions(ctx context.Context, username string) ([]db.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	sessions := []db.Session{}
+	for _, session := range store.sessions {
+		if session.Username == username && !session.IsBlocked && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (store *memoryStore) ListAllUserSessions(ctx context.Context, username string) ([]db.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	sessions := []db.Session{}
+	for _, session := range store.sessions {
+		if session.Username == username {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (store *memoryStore) TouchSession(ctx context.Context, id uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if session, ok := store.sessions[id]; ok {
+		session.LastSeenAt = time.Now()
+		store.sessions[id] = session
+	}
+	return nil
+}
+
+func (store *memoryStore) BlockSession(ctx context.Context, id uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if session, ok := store.sessions[id]; ok {
+		session.IsBlocked = true
+		store.sessions[id] = session
+	}
+	return nil
+}
+
+func (store *memoryStore) BlockUserSessions(ctx context.Context, username string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, session := range store.sessions {
+		if session.Username == username {
+			session.IsBlocked = true
+			store.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) UpsertUserRevocation(ctx context.Context, arg db.UpsertUserRevocationParams) (db.UserRevocation, error) {
+	return db.UserRevocation{
+		Username:      arg.Username,
+		RevokedBefore: arg.RevokedBefore,
+		ExpiresAt:     arg.ExpiresAt,
+	}, nil
+}
+
+func (store *memoryStore) CreateRevokedToken(ctx context.Context, arg db.CreateRevokedTokenParams) error {
+	return nil
+}
+
+// updateUser applies update to a stored user, or fails like an UPDATE matching no row
+func (store *memoryStore) updateUser(username string, update func(user *db.User) bool) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[username]
+	if !ok || !update(&user) {
+		return db.User{}, sql.ErrNoRows
+	}
+	store.users[username] = user
+	return user, nil
+}
+
+func (store *memoryStore) SetUserTotpSecret(ctx context.Context, arg db.SetUserTotpSecretParams) (db.User, error) {
+	return store.updateUser(arg.Username, func(user *db.User) bool {
+		if user.TotpEnabled {
+			return false
+		}
+		user.TotpSecret = arg.TotpSecret
+		user.TotpLastCounter = 0
+		return true
+	})
+}
+
+func (store *memoryStore) EnableUserTotp(ctx context.Context, username string) (db.User, error) {
+	return store.updateUser(username, func(user *db.User) bool {
+		user.TotpEnabled = user.TotpSecret.Valid
+		return user.TotpSecret.Valid
+	})
+}
+
+func (store *memoryStore) DisableUserTotp(ctx context.Context, username string) (db.User, error) {
+	return store.updateUser(username, func(user *db.User) bool {
+		user.TotpSecret = sql.NullString{}
+		user.TotpEnabled = false
+		user.TotpLastCounter = 0
+		return true
+	})
+}
+
+func (store *memoryStore) UpdateUserTotpCounter(ctx context.Context, arg db.UpdateUserTotpCounterParams) (db.User, error) {
+	return store.updateUser(arg.Username, func(user *db.User) bool {
+		if user.TotpLastCounter >= arg.TotpLastCounter {
+			return false
+		}
+		user.TotpLastCounter = arg.TotpLastCounter
+		return true
+	})
+}
+
+func (store *memoryStore) UpdateUserMfaRequired(ctx context.Context, arg db.UpdateUserMfaRequiredParams) (db.User, error) {
+	return store.updateUser(arg.Username, func(user *db.User) bool {
+		user.MfaRequired = arg.MfaRequired
+		return true
+	})
+}
+
+func (store *memoryStore) CreateRecoveryCode(ctx context.Context, arg db.CreateRecoveryCodeParams) (db.RecoveryCode, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	recoveryCode := db.RecoveryCode{
+		CodeHash:  arg.CodeHash,
+		Username:  arg.Username,
+		CreatedAt: time.Now(),
+	}
+	store.recoveryCodes[recoveryCode.CodeHash] = recoveryCode
+	return recoveryCode, nil
+}
+
+func (store *memoryStore) UseRecoveryCode(ctx context.Context, arg db.UseRecoveryCodeParams) (db.RecoveryCode, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	recoveryCode, ok := store.recoveryCodes[arg.CodeHash]
+	if !ok || recoveryCode.Username != arg.Username || recoveryCode.UsedAt.Valid {
+		return db.RecoveryCode{}, sql.ErrNoRows
+	}
+	recoveryCode.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.recoveryCodes[arg.CodeHash] = recoveryCode
+	return recoveryCode, nil
+}
+
+func (store *memoryStore) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for codeHash, recoveryCode := range store.recoveryCodes {
+		if recoveryCode.Username == username {
+			delete(store.recoveryCodes, codeHash)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) CreateOidcLogin(ctx context.Context, arg db.CreateOidcLoginParams) (db.OidcLogin, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	login := db.OidcLogin{
+		State:        arg.State,
+		Provider:     arg.Provider,
+		Nonce:        arg.Nonce,
+		CodeVerifier: arg.CodeVerifier,
+		ExpiresAt:    arg.ExpiresAt,
+		CreatedAt:    time.Now(),
+	}
+	store.oidcLogins[login.State] = login
+	return login, nil
+}
+
+func (store *memoryStore) UseOidcLogin(ctx context.Context, arg db.UseOidcLoginParams) (db.OidcLogin, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	login, ok := store.oidcLogins[arg.State]
+	if !ok || login.Provider != arg.Provider || !login.ExpiresAt.After(time.Now()) {
+		return db.OidcLogin{}, sql.ErrNoRows
+	}
+	delete(store.oidcLogins, arg.State)
+	return login, nil
+}
+
+func (store *memoryStore) DeleteExpiredOidcLogins(ctx context.Context) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for state, login := range store.oidcLogins {
+		if !login.ExpiresAt.After(time.Now()) {
+			delete(store.oidcLogins, state)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) CreateUserIdentity(ctx context.Context, arg db.CreateUserIdentityParams) (db.UserIdentity, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := arg.Provider + "|" + arg.Subject
+	if _, ok := store.identities[key]; ok {
+		return db.UserIdentity{}, &pq.Error{Code: "23505", Constraint: "user_identities_pkey"}
+	}
+	identity := db.UserIdentity{
+		Provider:  arg.Provider,
+		Subject:   arg.Subject,
+		Username:  arg.Username,
+		Email:     arg.Email,
+		CreatedAt: time.Now(),
+	}
+	store.identities[key] = identity
+	return identity, nil
+}
+
+func (store *memoryStore) GetUserIdentity(ctx context.Context, arg db.GetUserIdentityParams) (db.UserIdentity, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	identity, ok := store.identities[arg.Provider+"|"+arg.Subject]
+	if !ok {
+		return db.UserIdentity{}, sql.ErrNoRows
+	}
+	return identity, nil
+}
+
+func (store *memoryStore) CreateClient(ctx context.Context, arg db.CreateClientParams) (db.Client, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.clients[arg.ClientID]; ok {
+		return db.Client{}, &pq.Error{Code: "23505", Constraint: "clients_pkey"}
+	}
+	client := db.Client{
+		ClientID:         arg.ClientID,
+		ClientSecretHash: arg.ClientSecretHash,
+		Scopes:           arg.Scopes,
+		CreatedAt:        time.Now(),
+		Name:             arg.Name,
+		RedirectUris:     arg.RedirectUris,
+	}
+	store.clients[client.ClientID] = client
+	return client, nil
+}
+
+func (store *memoryStore) GetClient(ctx context.Context, clientID string) (db.Client, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	client, ok := store.clients[clientID]
+	if !ok {
+		return db.Client{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func (store *memoryStore) GetConsent(ctx context.Context, arg db.GetConsentParams) (db.Consent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	consent, ok := store.consents[arg.Username+"|"+arg.ClientID]
+	if !ok {
+		return db.Consent{}, sql.ErrNoRows
+	}
+	return consent, nil
+}
+
+func (store *memoryStore) UpsertConsent(ctx context.Context, arg db.UpsertConsentParams) (db.Consent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := arg.Username + "|" + arg.ClientID
+	consent, ok := store.consents[key]
+	if !ok {
+		consent = db.Consent{Username: arg.Username, ClientID: arg.ClientID, CreatedAt: time.Now()}
+	}
+	consent.Scopes = arg.Scopes
+	store.consents[key] = consent
+	return consent, nil
+}
+
+func (store *memoryStore) CreateAuthorizationCode(ctx context.Context, arg db.CreateAuthorizationCodeParams) (db.AuthorizationCode, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	code := db.AuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		Username:      arg.Username,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		Nonce:         arg.Nonce,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+		CreatedAt:     time.Now(),
+	}
+	store.authCodes[code.CodeHash] = code
+	return code, nil
+}
+
+func (store *memoryStore) UseAuthorizationCode(ctx context.Context, codeHash string) (db.AuthorizationCode, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	code, ok := store.authCodes[codeHash]
+	if !ok || !code.ExpiresAt.After(time.Now()) {
+		return db.AuthorizationCode{}, sql.ErrNoRows
+	}
+	delete(store.authCodes, codeHash)
+	return code, nil
+}
+
+func (store *memoryStore) DeleteExpiredAuthorizationCodes(ctx context.Context) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for codeHash, code := range store.authCodes {
+		if !code.ExpiresAt.After(time.Now()) {
+			delete(store.authCodes, codeHash)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) GetLoginAttempt(ctx context.Context, arg db.GetLoginAttemptParams) (db.LoginAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	attempt, ok := store.loginAttempts[arg.Kind+"|"+arg.Identifier]
+	if !ok {
+		return db.LoginAttempt{}, sql.ErrNoRows
+	}
+	return attempt, nil
+}
+
+func (store *memoryStore) RecordLoginFailure(ctx context.Context, arg db.RecordLoginFailureParams) (db.LoginAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := arg.Kind + "|" + arg.Identifier
+	attempt, ok := store.loginAttempts[key]
+	if !ok || attempt.LastFailureAt.Before(arg.ResetBefore) {
+		attempt = db.LoginAttempt{Kind: arg.Kind, Identifier: arg.Identifier, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = time.Now()
+	store.loginAttempts[key] = attempt
+	return attempt, nil
+}
+
+func (store *memoryStore) LockLogin(ctx context.Context, arg db.LockLoginParams) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := arg.Kind + "|" + arg.Identifier
+	if attempt, ok := store.loginAttempts[key]; ok {
+		attempt.LockedUntil = arg.LockedUntil
+		store.loginAttempts[key] = attempt
+	}
+	return nil
+}
+
+func (store *memoryStore) DeleteLoginAttempt(ctx context.Context, arg db.DeleteLoginAttemptParams) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.loginAttempts, arg.Kind+"|"+arg.Identifier)
+	return nil
+}
+
+func (store *memoryStore) DeleteExpiredLoginAttempts(ctx context.Context, lastFailureAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key, attempt := range store.loginAttempts {
+		locked := attempt.LockedUntil.Valid && attempt.LockedUntil.Time.After(time.Now())
+		if attempt.LastFailureAt.Before(lastFailureAt) && !locked {
+			delete(store.loginAttempts, key)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) CreateLoginEvent(ctx context.Context, arg db.CreateLoginEventParams) (db.LoginEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	event := db.LoginEvent{
+		ID:        int64(len(store.loginEvents) + 1),
+		Username:  arg.Username,
+		Success:   arg.Success,
+		ClientIp:  arg.ClientIp,
+		UserAgent: arg.UserAgent,
+		Device:    arg.Device,
+		CreatedAt: time.Now(),
+	}
+	store.loginEvents = append(store.loginEvents, event)
+	return event, nil
+}
+
+func (store *memoryStore) GetKnownLoginSources(ctx context.Context, arg db.GetKnownLoginSourcesParams) (db.GetKnownLoginSourcesRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var row db.GetKnownLoginSourcesRow
+	for _, event := range store.loginEvents {
+		if event.Username != arg.Username || !event.Success {
+			continue
+		}
+		row.KnownDevice = row.KnownDevice || event.Device == arg.Device
+		row.KnownIp = row.KnownIp || event.ClientIp == arg.ClientIp
+		row.Logins++
+	}
+	return row, nil
+}
+
+func (store *memoryStore) ListLoginEvents(ctx context.Context, arg db.ListLoginEventsParams) ([]db.LoginEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := []db.LoginEvent{}
+	for i := len(store.loginEvents) - 1; i >= 0; i-- {
+		if store.loginEvents[i].Username == arg.Username {
+			events = append(events, store.loginEvents[i])
+		}
+	}
+	start := min(int(arg.Offset), len(events))
+	end := min(start+int(arg.Limit), len(events))
+	return events[start:end], nil
+}
+
+func (store *memoryStore) ListImpersonations(ctx context.Context, arg db.ListImpersonationsParams) ([]db.Impersonation, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	impersonations := []db.Impersonation{}
+	for i := len(store.impersonations) - 1; i >= 0; i-- {
+		if store.impersonations[i].TargetUsername == arg.TargetUsername {
+			impersonations = append(impersonations, store.impersonations[i])
+		}
+	}
+	start := min(int(arg.Offset), len(impersonations))
+	end := min(start+int(arg.Limit), len(impersonations))
+	return impersonations[start:end], nil
+}
+
+func (store *memoryStore) RevokeUserApiKeys(ctx context.Context, username string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.apiKeysRevoked = append(store.apiKeysRevoked, username)
+	return nil
+}
+
+func (store *memoryStore) ScheduleAccountDeletion(ctx context.Context, arg db.ScheduleAccountDeletionParams) (db.AccountDeletion, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deletion, ok := store.deletions[arg.Username]
+	if !ok {
+		deletion = db.AccountDeletion{Username: arg.Username, CreatedAt: time.Now()}
+	}
+	deletion.DeleteAfter = arg.DeleteAfter
+	store.deletions[arg.Username] = deletion
+	return deletion, nil
+}
+
+func (store *memoryStore) CancelAccountDeletion(ctx context.Context, username string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.deletions, username)
+	return nil
+}
+
+func (store *memoryStore) ListDueAccountDeletions(ctx context.Context, limit int32) ([]db.AccountDeletion, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deletions := []db.AccountDeletion{}
+	for _, deletion := range store.deletions {
+		if !deletion.DeleteAfter.After(time.Now()) {
+			deletions = append(deletions, deletion)
+		}
+	}
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].DeleteAfter.Before(deletions[j].DeleteAfter)
+	})
+	return deletions[:min(int(limit), len(deletions))], nil
+}
+
+// DeleteAccountTx removes the user and, like the foreign keys do, everything
+// that hangs off them. The audit trail of impersonations stays.
+func (store *memoryStore) DeleteAccountTx(ctx context.Context, arg db.DeleteAccountTxParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deletion, ok := store.deletions[arg.Username]
+	user, exists := store.users[arg.Username]
+	if !ok || !exists || deletion.DeleteAfter.After(time.Now()) {
+		return db.User{}, sql.ErrNoRows
+	}
+	if err := arg.AfterDelete(user); err != nil {
+		return db.User{}, err
+	}
+	delete(store.users, user.Username)
+	delete(store.deletions, user.Username)
+	for id, session := range store.sessions {
+		if session.Username == user.Username {
+			delete(store.sessions, id)
+		}
+	}
+	for hash, userToken := range store.userTokens {
+		if userToken.Username == user.Username {
+			delete(store.userTokens, hash)
+		}
+	}
+	for key, code := range store.recoveryCodes {
+		if code.Username == user.Username {
+			delete(store.recoveryCodes, key)
+		}
+	}
+	for key, identity := range store.identities {
+		if identity.Username == user.Username {
+			delete(store.identities, key)
+		}
+	}
+	for key, consent := range store.consents {
+		if consent.Username == user.Username {
+			delete(store.consents, key)
+		}
+	}
+	for key, code := range store.authCodes {
+		if code.Username == user.Username {
+			delete(store.authCodes, key)
+		}
+	}
+	events := store.loginEvents[:0]
+	for _, event := range store.loginEvents {
+		if event.Username != user.Username {
+			events = append(events, event)
+		}
+	}
+	store.loginEvents = events
+	renames := store.renames[:0]
+	for _, rename := range store.renames {
+		if rename.Username != user.Username {
+			renames = append(renames, rename)
+		}
+	}
+	store.renames = renames
+	return user, nil
+}
+
+func (store *memoryStore) GetUsernameReservation(ctx context.Context, oldUsername string) (db.UsernameChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i := len(store.renames) - 1; i >= 0; i-- {
+		rename := store.renames[i]
+		if rename.OldUsername == oldUsername && rename.ReservedUntil.After(time.Now()) {
+			return rename, nil
+		}
+	}
+	return db.UsernameChange{}, sql.ErrNoRows
+}
+
+func (store *memoryStore) ListUsernameChanges(ctx context.Context, username string) ([]db.UsernameChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	renames := []db.UsernameChange{}
+	for i := len(store.renames) - 1; i >= 0; i-- {
+		if store.renames[i].Username == username {
+			renames = append(renames, store.renames[i])
+		}
+	}
+	return renames, nil
+}
+
+// RenameUserTx moves the user and, like the foreign keys do, everything that
+// hangs off them to the new name. The audit trail of impersonations keeps the old one.
+func (store *memoryStore) RenameUserTx(ctx context.Context, arg db.RenameUserTxParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[arg.Username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	if _, taken := store.users[arg.NewUsername]; taken {
+		return db.User{}, &pq.Error{Code: "23505", Constraint: "users_pkey"}
+	}
+	user.Username = arg.NewUsername
+	if err := arg.AfterRename(user); err != nil {
+		return db.User{}, err
+	}
+	delete(store.users, arg.Username)
+	store.users[user.Username] = user
+	for id, session := range store.sessions {
+		if session.Username == arg.Username {
+			session.Username = user.Username
+			store.sessions[id] = session
+		}
+	}
+	for hash, userToken := range store.userTokens {
+		if userToken.Username == arg.Username {
+			userToken.Username = user.Username
+			store.userTokens[hash] = userToken
+		}
+	}
+	for hash, code := range store.recoveryCodes {
+		if code.Username == arg.Username {
+			code.Username = user.Username
+			store.recoveryCodes[hash] = code
+		}
+	}
+	for key, identity := range store.identities {
+		if identity.Username == arg.Username {
+			identity.Username = user.Username
+			store.identities[key] = identity
+		}
+	}
+	for key, consent := range store.consents {
+		if consent.Username == arg.Username {
+			delete(store.consents, key)
+			consent.Username = user.Username
+			store.consents[consent.Username+"|"+consent.ClientID] = consent
+		}
+	}
+	for hash, code := range store.authCodes {
+		if code.Username == arg.Username {
+			code.Username = user.Username
+			store.authCodes[hash] = code
+		}
+	}
+	for i, event := range store.loginEvents {
+		if event.Username == arg.Username {
+			store.loginEvents[i].Username = user.Username
+		}
+	}
+	if deletion, ok := store.deletions[arg.Username]; ok {
+		delete(store.deletions, arg.Username)
+		deletion.Username = user.Username
+		store.deletions[user.Username] = deletion
+	}
+	for i, rename := range store.renames {
+		if rename.Username == arg.Username {
+			store.renames[i].Username = user.Username
+		}
+	}
+	store.renames = append(store.renames, db.UsernameChange{
+		ID:            int64(len(store.renames) + 1),
+		OldUsername:   arg.Username,
+		Username:      user.Username,
+		ReservedUntil: arg.ReservedUntil,
+		ChangedAt:     time.Now(),
+	})
+	return user, nil
+}
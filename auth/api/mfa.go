@@ -0,0 +1,519 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets when enabling TOTP
+const recoveryCodeCount = 10
+
+var (
+	errInvalidMFACode   = errors.New("invalid two-factor authentication code")
+	errInvalidMFAToken  = errors.New("invalid mfa token")
+	errTotpEnabled      = errors.New("two-factor authentication is already enabled")
+	errTotpNotEnabled   = errors.New("two-factor authentication is not enabled")
+	errTotpNotEnrolled  = errors.New("no pending two-factor enrollment, enroll first")
+	recoveryCodeEncoder = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type mfaPendingResponse struct {
+	MFARequired        bool      `json:"mfa_required"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	MFAToken           string    `json:"mfa_token"`
+	MFATokenExpiresAt  time.Time `json:"mfa_token_expires_at"`
+}
+
+// startMFALogin answers a correct password with an mfa_pending token. Users who
+// were required to use TOTP but have not enrolled yet enroll with that token.
+func (server *Server) startMFALogin(ctx *gin.Context, user db.User) {
+	mfaToken, mfaPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.MFATokenDuration,
+		token.WithMFAPending(),
+		token.WithPermissions([]string{}),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the database tells whether the token was used, so it signs in once
+	// however many requests race to redeem it
+	_, err = server.store.CreateUserToken(ctx, db.CreateUserTokenParams{
+		TokenHash: hashToken(mfaToken),
+		Username:  user.Username,
+		Purpose:   userTokenMFAPending,
+		ExpiresAt: mfaPayload.ExpiredAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := mfaPendingResponse{
+		MFARequired:        true,
+		EnrollmentRequired: !user.TotpEnabled,
+		MFAToken:           mfaToken,
+		MFATokenExpiresAt:  mfaPayload.ExpiredAt,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// verifyMFAToken checks an unused mfa_pending token and returns the user it was issued to
+func (server *Server) verifyMFAToken(ctx *gin.Context, mfaToken string) (db.User, error) {
+	payload, err := server.tokenMaker.VerifyToken(mfaToken)
+	if err != nil {
+		return db.User{}, err
+	}
+	if !payload.MFAPending {
+		return db.User{}, errInvalidMFAToken
+	}
+	if server.revocations.IsRevoked(payload) {
+		return db.User{}, errRevokedToken
+	}
+	_, err = server.store.GetUserToken(ctx, db.GetUserTokenParams{
+		TokenHash: hashToken(mfaToken),
+		Purpose:   userTokenMFAPending,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return db.User{}, errInvalidMFAToken
+		}
+		return db.User{}, err
+	}
+	return server.store.GetUser(ctx, payload.Username)
+}
+
+type completeMFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type completeMFALoginResponse struct {
+	loginUserResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// completeMFALogin exchanges an mfa_pending token and a TOTP or recovery code
+// for a normal session. The first code of a required enrollment enables TOTP.
+func (server *Server) completeMFALogin(ctx *gin.Context) {
+	var req completeMFALoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, err := server.verifyMFAToken(ctx, req.MFAToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	// codes are guessed like passwords, they count towards the same lockout
+	lockedFor, err := server.loginLockedFor(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return
+	}
+
+	enrolling := !user.TotpEnabled
+	if enrolling && !user.TotpSecret.Valid {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTotpNotEnrolled))
+		return
+	}
+	var ok bool
+	if enrolling {
+		ok, err = server.checkTotp(ctx, user, req.Code)
+	} else {
+		ok, err = server.checkSecondFactor(ctx, user, req.Code)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !ok {
+		server.rejectMFACode(ctx, user)
+		return
+	}
+
+	// each mfa_pending token signs in at most once, it is redeemed before
+	// anything of the account changes so a request losing the race changes nothing
+	_, err = server.store.UseUserToken(ctx, db.UseUserTokenParams{
+		TokenHash: hashToken(req.MFAToken),
+		Purpose:   userTokenMFAPending,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFAToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	var recoveryCodes []string
+	if enrolling {
+		recoveryCodes, err = server.enableTotp(ctx, user.Username)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+	session, err := server.createSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if err := server.recordLogin(ctx, user, true); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := completeMFALoginResponse{
+		loginUserResponse: session,
+		RecoveryCodes:     recoveryCodes,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// rejectMFACode counts a wrong code of a login as a failed login
+func (server *Server) rejectMFACode(ctx *gin.Context, user db.User) {
+	if err := server.recordLoginFailure(ctx, user.Username); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if err := server.recordLogin(ctx, user, false); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFACode))
+}
+
+// rejectUserMFACode counts a wrong code of a signed in user as a failed
+// login, so a stolen session cannot guess codes without limit
+func (server *Server) rejectUserMFACode(ctx *gin.Context, user db.User) {
+	if err := server.recordLoginFailure(ctx, user.Username); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFACode))
+}
+
+type enrollTotpResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// enrollTotp gives user a new TOTP secret. It only takes effect once a code
+// generated from it is confirmed.
+func (server *Server) enrollTotp(ctx *gin.Context, user db.User) {
+	if user.TotpEnabled {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTotpEnabled))
+		return
+	}
+	secret, err := utils.NewTotpSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.SetUserTotpSecret(ctx, db.SetUserTotpSecretParams{
+		Username:   user.Username,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errTotpEnabled))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := enrollTotpResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TotpProvisioningURI(server.config.TokenIssuer, user.Username, secret),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// enrollUserTotp starts TOTP enrollment for the signed in user
+func (server *Server) enrollUserTotp(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.enrollTotp(ctx, user)
+}
+
+type enrollMFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// enrollMFALogin starts TOTP enrollment during the login of a user who was
+// required to use it, they finish signing in with the first code
+func (server *Server) enrollMFALogin(ctx *gin.Context) {
+	var req enrollMFALoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, err := server.verifyMFAToken(ctx, req.MFAToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	server.enrollTotp(ctx, user)
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type confirmTotpResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// confirmUserTotp enables TOTP for the signed in user with a first code from
+// their authenticator and hands out their recovery codes
+func (server *Server) confirmUserTotp(ctx *gin.Context) {
+	var req mfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.TotpEnabled {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTotpEnabled))
+		return
+	}
+	if !user.TotpSecret.Valid {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTotpNotEnrolled))
+		return
+	}
+	lockedFor, err := server.loginLockedFor(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return
+	}
+	recoveryCodes, err := server.confirmTotp(ctx, user, req.Code)
+	if err != nil {
+		if err == errInvalidMFACode {
+			server.rejectUserMFACode(ctx, user)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, confirmTotpResponse{RecoveryCodes: recoveryCodes})
+}
+
+// confirmTotp enables the pending TOTP secret of user when code matches it and
+// returns a fresh set of recovery codes
+func (server *Server) confirmTotp(ctx *gin.Context, user db.User, code string) ([]string, error) {
+	ok, err := server.checkTotp(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+	return server.enableTotp(ctx, user.Username)
+}
+
+// enableTotp turns TOTP on for username and returns their new recovery codes
+func (server *Server) enableTotp(ctx *gin.Context, username string) ([]string, error) {
+	_, err := server.store.EnableUserTotp(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return server.createRecoveryCodes(ctx, username)
+}
+
+// disableUserTotp turns TOTP off for the signed in user, which takes a current
+// code or a recovery code. Users required to use it by an admin cannot.
+func (server *Server) disableUserTotp(ctx *gin.Context) {
+	var req mfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !user.TotpEnabled {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTotpNotEnabled))
+		return
+	}
+	if user.MfaRequired {
+		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("two-factor authentication is required for this account")))
+		return
+	}
+	lockedFor, err := server.loginLockedFor(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return
+	}
+	ok, err := server.checkSecondFactor(ctx, user, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !ok {
+		server.rejectUserMFACode(ctx, user)
+		return
+	}
+	_, err = server.store.DisableUserTotp(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.store.DeleteRecoveryCodes(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// checkSecondFactor accepts a TOTP code or one of the unused recovery codes of user
+func (server *Server) checkSecondFactor(ctx *gin.Context, user db.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if _, ok := utils.ValidateTotp(user.TotpSecret.String, code, time.Now()); ok {
+		return server.checkTotp(ctx, user, code)
+	}
+	_, err := server.store.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		CodeHash: hashToken(normalizeRecoveryCode(code)),
+		Username: user.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// checkTotp validates a TOTP code of user and records its time step, so the
+// same code cannot be used twice
+func (server *Server) checkTotp(ctx *gin.Context, user db.User, code string) (bool, error) {
+	counter, ok := utils.ValidateTotp(user.TotpSecret.String, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false, nil
+	}
+	_, err := server.store.UpdateUserTotpCounter(ctx, db.UpdateUserTotpCounterParams{
+		Username:        user.Username,
+		TotpLastCounter: counter,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// createRecoveryCodes replaces the recovery codes of username. Only their
+// hashes are stored, the codes are shown to the user once.
+func (server *Server) createRecoveryCodes(ctx *gin.Context, username string) ([]string, error) {
+	err := server.store.DeleteRecoveryCodes(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoder.EncodeToString(raw))
+		_, err = server.store.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			CodeHash: hashToken(code),
+			Username: username,
+		})
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, code[:8]+"-"+code[8:])
+	}
+	return recoveryCodes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting of recovery codes, so they can
+// be typed with any case and with or without the dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+type requireMFARequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Required *bool  `json:"required" binding:"required"`
+}
+
+type requireMFAResponse struct {
+	Username    string `json:"username"`
+	MFARequired bool   `json:"mfa_required"`
+	TotpEnabled bool   `json:"totp_enabled"`
+}
+
+// requireMFA lets admins make two-factor authentication mandatory for a user.
+// Users without TOTP are asked to enroll at their next login.
+func (server *Server) requireMFA(ctx *gin.Context) {
+	var req requireMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageUsers) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can require two-factor authentication")))
+		return
+	}
+	user, err := server.store.UpdateUserMfaRequired(ctx, db.UpdateUserMfaRequiredParams{
+		Username:    req.Username,
+		MfaRequired: *req.Required,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := requireMFAResponse{
+		Username:    user.Username,
+		MFARequired: user.MfaRequired,
+		TotpEnabled: user.TotpEnabled,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
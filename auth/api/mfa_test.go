@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+// serveJSON sends body to the test server, with a bearer token when accessToken is set
+func serveJSON(t *testing.T, server *Server, method string, path string, body gin.H, accessToken string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(method, path, bytes.NewReader(data))
+	require.NoError(t, err)
+	if accessToken != "" {
+		request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+accessToken)
+	}
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decodeJSON(t *testing.T, recorder *httptest.ResponseRecorder, v any) {
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), v))
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	code, err := utils.TotpCode(secret, utils.TotpCounter(at))
+	require.NoError(t, err)
+	return code
+}
+
+func TestTotpLogin(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	credentials := gin.H{"username": "alice", "password": "secret"}
+
+	recorder := serveJSON(t, server, http.MethodPost, "/login", credentials, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var session loginUserResponse
+	decodeJSON(t, recorder, &session)
+	require.NotEmpty(t, session.AccessToken)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/enroll", nil, session.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var enrollment enrollTotpResponse
+	decodeJSON(t, recorder, &enrollment)
+	require.Contains(t, enrollment.ProvisioningURI, enrollment.Secret)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/confirm", gin.H{"code": "000000"}, session.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// enrolling alone does not change how alice signs in
+	recorder = serveJSON(t, server, http.MethodPost, "/login", credentials, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotContains(t, recorder.Body.String(), "mfa_token")
+	now := time.Now()
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/confirm", gin.H{"code": totpCode(t, enrollment.Secret, now)}, session.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var confirmation confirmTotpResponse
+	decodeJSON(t, recorder, &confirmation)
+	require.Len(t, confirmation.RecoveryCodes, recoveryCodeCount)
+	require.True(t, store.users["alice"].TotpEnabled)
+
+	login := func(t *testing.T) string {
+		recorder := serveJSON(t, server, http.MethodPost, "/login", credentials, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var pending mfaPendingResponse
+		decodeJSON(t, recorder, &pending)
+		require.True(t, pending.MFARequired)
+		require.False(t, pending.EnrollmentRequired)
+		require.NotEmpty(t, pending.MFAToken)
+		return pending.MFAToken
+	}
+	mfaToken := login(t)
+
+	// the mfa_pending token grants no access on its own
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/enroll", nil, mfaToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": "000000"}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// the code used to confirm cannot be replayed
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": totpCode(t, enrollment.Secret, now)}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recoveryCode := confirmation.RecoveryCodes[0]
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": recoveryCode}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &session)
+	require.NotEmpty(t, session.AccessToken)
+	require.Equal(t, "alice", session.User.Username)
+
+	// each mfa_pending token and recovery code works once
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": confirmation.RecoveryCodes[1]}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	mfaToken = login(t)
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": recoveryCode}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	next := now.Add(30 * time.Second)
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": mfaToken, "code": totpCode(t, enrollment.Secret, next)}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &session)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/disable", gin.H{"code": confirmation.RecoveryCodes[2]}, session.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.False(t, store.users["alice"].TotpEnabled)
+	require.Empty(t, store.recoveryCodes)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login", credentials, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotContains(t, recorder.Body.String(), "mfa_token")
+}
+
+func TestTotpCodesCountTowardsLockout(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	alice := loginTestUser(t, server, "alice")
+	bob := loginTestUser(t, server, "bob")
+
+	enroll := func(accessToken string) enrollTotpResponse {
+		recorder := serveJSON(t, server, http.MethodPost, "/mfa/enroll", nil, accessToken)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var enrollment enrollTotpResponse
+		decodeJSON(t, recorder, &enrollment)
+		return enrollment
+	}
+
+	// wrong codes from a signed in session count like wrong passwords
+	enrollment := enroll(alice)
+	recorder := serveJSON(t, server, http.MethodPost, "/mfa/confirm", gin.H{"code": totpCode(t, enrollment.Secret, time.Now())}, alice)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var confirmation confirmTotpResponse
+	decodeJSON(t, recorder, &confirmation)
+	for i := 0; i < server.config.LoginMaxAttempts; i++ {
+		recorder = serveJSON(t, server, http.MethodPost, "/mfa/disable", gin.H{"code": "000000"}, alice)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/disable", gin.H{"code": confirmation.RecoveryCodes[0]}, alice)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.True(t, store.users["alice"].TotpEnabled)
+
+	enrollment = enroll(bob)
+	for i := 0; i < server.config.LoginMaxAttempts; i++ {
+		recorder = serveJSON(t, server, http.MethodPost, "/mfa/confirm", gin.H{"code": "000000"}, bob)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/confirm", gin.H{"code": totpCode(t, enrollment.Secret, time.Now())}, bob)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.False(t, store.users["bob"].TotpEnabled)
+}
+
+func TestRequireMFA(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+
+	userToken, _, err := server.tokenMaker.CreateToken("someone", "user", time.Minute)
+	require.NoError(t, err)
+	recorder := serveJSON(t, server, http.MethodPost, "/admin/mfa", gin.H{"username": "bob", "required": true}, userToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	adminToken, _, err := server.tokenMaker.CreateToken("admin", "admin", time.Minute)
+	require.NoError(t, err)
+	recorder = serveJSON(t, server, http.MethodPost, "/admin/mfa", gin.H{"username": "nobody", "required": true}, adminToken)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/admin/mfa", gin.H{"username": "bob", "required": true}, adminToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.True(t, store.users["bob"].MfaRequired)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "bob", "password": "secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var pending mfaPendingResponse
+	decodeJSON(t, recorder, &pending)
+	require.True(t, pending.EnrollmentRequired)
+	// the token is not a link sent to an address
+	require.False(t, store.userTokens[hashToken(pending.MFAToken)].Email.Valid)
+
+	// bob has to enroll before a code can be checked
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": pending.MFAToken, "code": "000000"}, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa/enroll", gin.H{"mfa_token": pending.MFAToken}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var enrollment enrollTotpResponse
+	decodeJSON(t, recorder, &enrollment)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login/mfa", gin.H{"mfa_token": pending.MFAToken, "code": totpCode(t, enrollment.Secret, time.Now())}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp completeMFALoginResponse
+	decodeJSON(t, recorder, &rsp)
+	require.NotEmpty(t, rsp.AccessToken)
+	require.Len(t, rsp.RecoveryCodes, recoveryCodeCount)
+	require.True(t, store.users["bob"].TotpEnabled)
+
+	// required two-factor authentication cannot be turned off by the user
+	recorder = serveJSON(t, server, http.MethodPost, "/mfa/disable", gin.H{"code": rsp.RecoveryCodes[0]}, rsp.AccessToken)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
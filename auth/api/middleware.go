@@ -9,18 +9,35 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"github.com/google/uuid"
+	"shivesh-ranjan.github.io/m/revocation"
 	"shivesh-ranjan.github.io/m/token"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	authorizationTypeApiKey = "apikey"
+	authorizationTypeKey    = "authorization_type"
 	authorizationPayloadKey = "authorization_payload"
 )
 
-// AuthMiddleware creates a gin middleware for authorization
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+var (
+	errRevokedToken    = errors.New("token has been revoked")
+	errMFAPendingToken = errors.New("two-factor authentication has not been completed")
+	errClientToken     = errors.New("tokens issued to applications only grant access to userinfo")
+)
+
+// apiKeyVerifier resolves an API key to the payload of its owner
+type apiKeyVerifier func(ctx *gin.Context, apiKey string) (*token.Payload, error)
+
+// sessionToucher records that a session was seen
+type sessionToucher func(ctx *gin.Context, sessionID uuid.UUID)
+
+// AuthMiddleware creates a gin middleware for authorization.
+// API keys are only accepted when apiKeys is not nil, sessions of the access
+// tokens are marked as seen when touchSession is not nil.
+func authMiddleware(tokenMaker token.Maker, revocations *revocation.Store, apiKeys apiKeyVerifier, touchSession sessionToucher) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -38,6 +55,17 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		}
 
 		authorizationType := strings.ToLower(fields[0])
+		if authorizationType == authorizationTypeApiKey && apiKeys != nil {
+			payload, err := apiKeys(ctx, fields[1])
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+				return
+			}
+			ctx.Set(authorizationTypeKey, authorizationType)
+			ctx.Set(authorizationPayloadKey, payload)
+			ctx.Next()
+			return
+		}
 		if authorizationType != authorizationTypeBearer {
 			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
@@ -50,24 +78,84 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 			return
 		}
+		if payload.MFAPending {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errMFAPendingToken))
+			return
+		}
+		if payload.ClientID != "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errClientToken))
+			return
+		}
+		if payload.Purpose != "" {
+			err := fmt.Errorf("%s tokens do not grant access", payload.Purpose)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		if revocations.IsRevoked(payload) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errRevokedToken))
+			return
+		}
+		if payload.SessionID != nil && touchSession != nil {
+			touchSession(ctx, *payload.SessionID)
+		}
 
+		ctx.Set(authorizationTypeKey, authorizationType)
 		ctx.Set(authorizationPayloadKey, payload)
 		ctx.Next()
 	}
 }
 
-// Gets User from Payload
-func (server *Server) getUserFromPayload(ctx *gin.Context) (db.User, error) {
-	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
-	user, err := server.store.GetUser(ctx, authPayload.Username)
-	if err != nil {
-		return user, errors.New("User doesn't exist for this session. That's weird.")
+// requireScope rejects API keys, services and impersonation tokens that were
+// not granted scope. Bearer tokens of users are not limited by scopes.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		scoped := ctx.GetString(authorizationTypeKey) == authorizationTypeApiKey ||
+			authPayload.IsService() ||
+			authPayload.IsImpersonated()
+		if scoped && !authPayload.HasPermission(scope) {
+			err := fmt.Errorf("missing the %s scope", scope)
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.Next()
 	}
-	return user, nil
 }
 
-// Reverse Proxy logic
-func proxyRequest(c *gin.Context, targetURL string, username string) {
+// requireUser rejects service and impersonation tokens on routes acting on
+// the account of a user
+func requireUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if authPayload.IsService() {
+			err := errors.New("services cannot act on user accounts")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		if authPayload.IsImpersonated() {
+			err := errors.New("impersonation tokens cannot act on user accounts")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// optionalAuth runs auth for requests with an authorization header and lets
+// anonymous requests through
+func optionalAuth(auth gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader(authorizationHeaderKey) == "" {
+			ctx.Next()
+			return
+		}
+		auth(ctx)
+	}
+}
+
+// Reverse Proxy logic.
+// payload is the authenticated principal, nil for anonymous requests.
+func proxyRequest(c *gin.Context, targetURL string, payload *token.Payload) {
 	client := &http.Client{Timeout: 10 * time.Second}
 
 	// Creating a new HTTP request based on the incoming Gin request
@@ -82,9 +170,19 @@ func proxyRequest(c *gin.Context, targetURL string, username string) {
 		req.Header[k] = v
 	}
 
-	// To add authenticated user info if required
-	if username != "" {
-		req.Header.Set("X-Username", username)
+	// identity headers are only ever set by us, never passed on from the client
+	req.Header.Del("X-Username")
+	req.Header.Del("X-Service")
+	req.Header.Del("X-Impersonator")
+	if payload != nil {
+		if payload.IsService() {
+			req.Header.Set("X-Service", payload.Username)
+		} else {
+			req.Header.Set("X-Username", payload.Username)
+		}
+		if payload.IsImpersonated() {
+			req.Header.Set("X-Impersonator", payload.Actor.Username)
+		}
 	}
 
 	// Performing the request
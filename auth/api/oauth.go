@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+var errInvalidClient = errors.New("invalid client credentials")
+
+// clientScopes are the scopes that can be granted to service clients
+var clientScopes = []string{token.ScopeWriteBlog, token.ScopeIntrospectToken}
+
+// oauthErrorResponse follows the error format of RFC 6749
+func oauthErrorResponse(code string, err error) gin.H {
+	return gin.H{"error": code, "error_description": err.Error()}
+}
+
+type introspectTokenRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// introspectTokenResponse follows RFC 7662. Only Active is set for tokens
+// that are not valid anymore.
+type introspectTokenResponse struct {
+	Active    bool   `json:"active"`
+	Username  string `json:"username,omitempty"`
+	SubType   string `json:"sub_type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+}
+
+// introspectToken lets services that cannot link the token package ask
+// whether a token is still active and who it was issued to
+func (server *Server) introspectToken(ctx *gin.Context) {
+	if !server.authenticateIntrospectionClient(ctx) {
+		ctx.Header("WWW-Authenticate", `Basic realm="introspection"`)
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidClient))
+		return
+	}
+	var req introspectTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// tokens exchanged for other services are active too, aud tells them apart
+	payload, err := server.tokenMaker.VerifyTokenForAnyAudience(req.Token)
+	if err != nil || payload.MFAPending || payload.ClientID != "" || payload.Purpose != "" || server.revocations.IsRevoked(payload) {
+		ctx.JSON(http.StatusOK, introspectTokenResponse{Active: false})
+		return
+	}
+	rsp := introspectTokenResponse{
+		Active:    true,
+		Username:  payload.Username,
+		SubType:   payload.SubjectType,
+		Role:      payload.Role,
+		Scope:     strings.Join(payload.Permissions, " "),
+		TokenType: "Bearer",
+		Iat:       payload.IssuedAt.Unix(),
+		Jti:       payload.ID.String(),
+		Iss:       payload.Issuer,
+		Aud:       payload.Audience,
+	}
+	if !payload.NeverExpires {
+		rsp.Exp = payload.ExpiredAt.Unix()
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// authenticateIntrospectionClient checks the HTTP basic credentials of the
+// request against the registered clients granted the introspection scope
+func (server *Server) authenticateIntrospectionClient(ctx *gin.Context) bool {
+	clientID, clientSecret, ok := ctx.Request.BasicAuth()
+	if !ok {
+		return false
+	}
+	client, err := server.authenticateClient(ctx, clientID, clientSecret)
+	return err == nil && slices.Contains(client.Scopes, token.ScopeIntrospectToken)
+}
+
+// authenticateClient checks the secret of a registered service client.
+// Secrets are random, so like API keys a plain hash protects them and the
+// unauthenticated endpoints calling this stay cheap.
+func (server *Server) authenticateClient(ctx *gin.Context, clientID string, clientSecret string) (db.Client, error) {
+	secretHash := hashToken(clientSecret)
+	client, err := server.store.GetClient(ctx, clientID)
+	if err != nil && err != sql.ErrNoRows {
+		return db.Client{}, err
+	}
+	// unknown clients are compared too, so they take as long as wrong secrets
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.ClientSecretHash)) != 1 || err != nil {
+		return db.Client{}, errInvalidClient
+	}
+	return client, nil
+}
+
+type tokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+type clientTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// issueToken is the OAuth2 token endpoint. Services get a token of their own
+// with the client_credentials grant, third-party applications redeem the
+// codes users approved them with the authorization_code grant.
+func (server *Server) issueToken(ctx *gin.Context) {
+	var req tokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_request", err))
+		return
+	}
+	if req.GrantType != "client_credentials" && req.GrantType != "authorization_code" {
+		err := fmt.Errorf("unsupported grant type %s", req.GrantType)
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse("unsupported_grant_type", err))
+		return
+	}
+	// credentials in the authorization header take precedence over the body
+	clientID, clientSecret, ok := ctx.Request.BasicAuth()
+	if !ok {
+		clientID, clientSecret = req.ClientID, req.ClientSecret
+	}
+	client, err := server.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		if err == errInvalidClient {
+			ctx.Header("WWW-Authenticate", `Basic realm="token"`)
+			ctx.JSON(http.StatusUnauthorized, oauthErrorResponse("invalid_client", err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+
+	if req.GrantType == "authorization_code" {
+		server.redeemAuthorizationCode(ctx, client, req)
+		return
+	}
+	server.issueClientToken(ctx, client, req)
+}
+
+// issueClientToken implements the OAuth2 client_credentials grant, giving
+// services a token of their own to call the gateway with
+func (server *Server) issueClientToken(ctx *gin.Context, client db.Client, req tokenRequest) {
+	// the scopes users consent to are never granted to the service itself
+	scopes := []string{}
+	for _, scope := range client.Scopes {
+		if slices.Contains(clientScopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(client.Scopes, scope) || !slices.Contains(clientScopes, scope) {
+				err := fmt.Errorf("scope %s is not granted to the client", scope)
+				ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_scope", err))
+				return
+			}
+		}
+	}
+	accessToken, _, err := server.tokenMaker.CreateToken(
+		client.ClientID,
+		"",
+		server.config.AccessTokenDuration,
+		token.WithSubjectType(token.SubjectTypeService),
+		token.WithPermissions(scopes),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	rsp := clientTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(server.config.AccessTokenDuration.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
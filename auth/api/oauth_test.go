@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	store := &clientStore{clients: map[string]db.Client{
+		"gateway": {
+			ClientID:         "gateway",
+			ClientSecretHash: hashToken("secret"),
+			Scopes:           []string{token.ScopeIntrospectToken},
+		},
+		"blog": {
+			ClientID:         "blog",
+			ClientSecretHash: hashToken("secret"),
+			Scopes:           []string{token.ScopeWriteBlog},
+		},
+	}}
+	server := NewTestServer(t, store)
+
+	accessToken, payload, err := server.tokenMaker.CreateToken("user", "admin", time.Minute)
+	require.NoError(t, err)
+	blogToken, _, err := server.tokenMaker.CreateToken("user", "admin", time.Minute, token.ForAudience("blog"))
+	require.NoError(t, err)
+
+	introspect := func(t *testing.T, tokenValue string, setupAuth func(request *http.Request)) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := url.Values{"token": {tokenValue}}.Encode()
+		request, err := http.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(body))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setupAuth(request)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	clientAuth := func(request *http.Request) {
+		request.SetBasicAuth("gateway", "secret")
+	}
+
+	testCases := []struct {
+		name          string
+		token         string
+		setupAuth     func(request *http.Request)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "Active",
+			token:     accessToken,
+			setupAuth: clientAuth,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var rsp introspectTokenResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.True(t, rsp.Active)
+				require.Equal(t, "user", rsp.Username)
+				require.Equal(t, "admin", rsp.Role)
+				require.Equal(t, payload.ID.String(), rsp.Jti)
+				require.Equal(t, payload.ExpiredAt.Unix(), rsp.Exp)
+				require.Equal(t, payload.IssuedAt.Unix(), rsp.Iat)
+				require.Equal(t, "auth", rsp.Iss)
+				require.Equal(t, "gateway", rsp.Aud)
+			},
+		},
+		{
+			name:      "OtherAudience",
+			token:     blogToken,
+			setupAuth: clientAuth,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var rsp introspectTokenResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.True(t, rsp.Active)
+				require.Equal(t, "blog", rsp.Aud)
+			},
+		},
+		{
+			name:      "InvalidToken",
+			token:     "invalid",
+			setupAuth: clientAuth,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active":false}`, recorder.Body.String())
+			},
+		},
+		{
+			name:  "WrongSecret",
+			token: accessToken,
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth("gateway", "wrong")
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:  "ClientWithoutScope",
+			token: accessToken,
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth("blog", "secret")
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "NoClientCredentials",
+			token:     accessToken,
+			setupAuth: func(request *http.Request) {},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			tc.checkResponse(t, introspect(t, tc.token, tc.setupAuth))
+		})
+	}
+}
+
+// clientStore keeps service clients in memory, the other queries are not implemented
+type clientStore struct {
+	db.Store
+	clients map[string]db.Client
+}
+
+func (store *clientStore) GetClient(ctx context.Context, clientID string) (db.Client, error) {
+	client, ok := store.clients[clientID]
+	if !ok {
+		return db.Client{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func TestIssueClientToken(t *testing.T) {
+	store := &clientStore{clients: map[string]db.Client{
+		"notification": {
+			ClientID:         "notification",
+			ClientSecretHash: hashToken("secret"),
+			Scopes:           []string{token.ScopeWriteBlog, token.ScopeIntrospectToken},
+		},
+	}}
+	server := NewTestServer(t, store)
+
+	requestToken := func(t *testing.T, form url.Values, setupAuth func(request *http.Request)) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setupAuth(request)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	clientAuth := func(request *http.Request) {
+		request.SetBasicAuth("notification", "secret")
+	}
+
+	recorder := requestToken(t, url.Values{"grant_type": {"client_credentials"}, "scope": {token.ScopeWriteBlog}}, clientAuth)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp clientTokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+	require.Equal(t, "Bearer", rsp.TokenType)
+	require.Equal(t, token.ScopeWriteBlog, rsp.Scope)
+
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.True(t, payload.IsService())
+	require.Equal(t, "notification", payload.Username)
+	require.Equal(t, []string{token.ScopeWriteBlog}, payload.Permissions)
+
+	// services cannot act on user accounts
+	recorder = httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/api-keys", nil)
+	require.NoError(t, err)
+	request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+rsp.AccessToken)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// credentials can also be sent in the body
+	recorder = requestToken(t, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"notification"},
+		"client_secret": {"secret"},
+	}, func(request *http.Request) {})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestToken(t, url.Values{"grant_type": {"client_credentials"}, "scope": {token.ScopeWriteProfile}}, clientAuth)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid_scope")
+
+	recorder = requestToken(t, url.Values{"grant_type": {"password"}}, clientAuth)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "unsupported_grant_type")
+
+	recorder = requestToken(t, url.Values{"grant_type": {"client_credentials"}}, func(request *http.Request) {
+		request.SetBasicAuth("notification", "wrong")
+	})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid_client")
+
+	// registered clients with the introspection scope can introspect tokens
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {rsp.AccessToken}}.Encode()))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	clientAuth(request)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var introspection introspectTokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &introspection))
+	require.True(t, introspection.Active)
+	require.Equal(t, token.SubjectTypeService, introspection.SubType)
+}
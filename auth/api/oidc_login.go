@@ -0,0 +1,308 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+const (
+	// oidcStateCookie binds a login to the browser that started it
+	oidcStateCookie = "oidc_state"
+	// maxUsernameLength keeps usernames derived from provider claims readable
+	maxUsernameLength = 20
+)
+
+var errInvalidOIDCLogin = errors.New("login is invalid or has expired, please sign in again")
+
+// newOIDCProviders creates the external providers users can sign in with,
+// each redirecting back to its own callback
+func newOIDCProviders(config utils.Config) (map[string]*oidc.Provider, error) {
+	configs, err := config.OIDCProviderConfigs()
+	if err != nil {
+		return nil, err
+	}
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, providerConfig := range configs {
+		redirectURL := fmt.Sprintf("%s/oidc/%s/callback", config.PublicURL, providerConfig.Name)
+		providers[providerConfig.Name] = oidc.NewProvider(providerConfig, redirectURL)
+	}
+	return providers, nil
+}
+
+type oidcProviderUri struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+// oidcProvider returns the provider named in the path of the request
+func (server *Server) oidcProvider(ctx *gin.Context) (*oidc.Provider, bool) {
+	var uri oidcProviderUri
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+	provider, ok := server.oidcProviders[uri.Provider]
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(fmt.Errorf("unknown provider %s", uri.Provider)))
+		return nil, false
+	}
+	return provider, true
+}
+
+// oidcLogin sends the user to an external provider to sign in
+func (server *Server) oidcLogin(ctx *gin.Context) {
+	provider, ok := server.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+	state, err := randomSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	nonce, err := randomSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, errorResponse(err))
+		return
+	}
+
+	// logins that were never finished are dropped as new ones start
+	err = server.store.DeleteExpiredOidcLogins(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.CreateOidcLogin(ctx, db.CreateOidcLoginParams{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(server.config.OIDCLoginDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, state, int(server.config.OIDCLoginDuration.Seconds()), oidcCookiePath(provider),
+		"", strings.HasPrefix(server.config.PublicURL, "https://"), true)
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+func oidcCookiePath(provider *oidc.Provider) string {
+	return "/oidc/" + provider.Name()
+}
+
+type oidcCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// oidcCallback finishes a login with an external provider. The identity is
+// linked to a local user, created on first login, who then signs in as usual.
+func (server *Server) oidcCallback(ctx *gin.Context) {
+	provider, ok := server.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.Error != "" {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(fmt.Errorf("%s: %s %s", provider.Name(), req.Error, req.ErrorDescription)))
+		return
+	}
+	// without the cookie an attacker could sign the user in to the attacker's account
+	cookie, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(req.State)) != 1 {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidOIDCLogin))
+		return
+	}
+	ctx.SetCookie(oidcStateCookie, "", -1, oidcCookiePath(provider), "", strings.HasPrefix(server.config.PublicURL, "https://"), true)
+
+	login, err := server.store.UseOidcLogin(ctx, db.UseOidcLoginParams{
+		State:    req.State,
+		Provider: provider.Name(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidOIDCLogin))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	claims, err := provider.Exchange(ctx, req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	user, err := server.oidcUser(ctx, provider.Name(), claims)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.TotpEnabled || user.MfaRequired {
+		server.startMFALogin(ctx, user)
+		return
+	}
+	rsp, err := server.createSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if err := server.recordLogin(ctx, user, true); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// oidcUser returns the local user linked to an external identity. On first
+// login the identity is linked to the user with the same verified email, or
+// to a new user when there is none.
+func (server *Server) oidcUser(ctx *gin.Context, providerName string, claims *oidc.Claims) (db.User, error) {
+	identity, err := server.store.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: providerName,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return server.store.GetUser(ctx, identity.Username)
+	}
+	if err != sql.ErrNoRows {
+		return db.User{}, err
+	}
+
+	email := sql.NullString{String: claims.Email, Valid: claims.Email != "" && claims.EmailVerified}
+	var user db.User
+	if email.Valid {
+		// both sides must have verified the address, or anyone could claim an account
+		user, err = server.store.GetUserByEmail(ctx, email)
+		if err != nil && err != sql.ErrNoRows {
+			return db.User{}, err
+		}
+		if err == nil && !user.EmailVerified {
+			user = db.User{}
+		}
+	}
+	if user.Username == "" {
+		user, err = server.createOIDCUser(ctx, claims, email)
+		if err != nil {
+			return db.User{}, err
+		}
+	}
+
+	_, err = server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Username: user.Username,
+		Email:    sql.NullString{String: claims.Email, Valid: claims.Email != ""},
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// createOIDCUser creates a user for an external identity. The username is
+// derived from the claims and the password is random, the user can set one
+// through the password reset flow.
+func (server *Server) createOIDCUser(ctx *gin.Context, claims *oidc.Claims, email sql.NullString) (db.User, error) {
+	password, err := randomSecret()
+	if err != nil {
+		return db.User{}, err
+	}
+	hashedPassword, err := server.passwordHasher.Hash(password)
+	if err != nil {
+		return db.User{}, err
+	}
+	name := claims.Name
+	base := oidcUsername(claims)
+	if name == "" {
+		name = base
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		reserved, err := server.usernameReserved(ctx, username, "")
+		if err != nil {
+			return db.User{}, err
+		}
+		if reserved {
+			if attempt >= 5 {
+				return db.User{}, errUsernameReserved
+			}
+			username = base + fmt.Sprint(utils.RandomInt(1000, 9999))
+			continue
+		}
+		user, err := server.store.CreateUser(ctx, db.CreateUserParams{
+			Username: username,
+			Name:     name,
+			Password: hashedPassword,
+			Photo:    claims.Picture,
+			Role:     "user",
+			Email:    email,
+		})
+		if err == nil {
+			if !email.Valid {
+				return user, nil
+			}
+			return server.store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{
+				Username: user.Username,
+				Email:    email,
+			})
+		}
+		pqErr, ok := err.(*pq.Error)
+		if !ok || pqErr.Code.Name() != "unique_violation" || attempt >= 5 {
+			return db.User{}, err
+		}
+		if pqErr.Constraint == "users_email_key" {
+			// an unverified local account holds the address, leave it to them
+			email = sql.NullString{}
+			continue
+		}
+		username = base + fmt.Sprint(utils.RandomInt(1000, 9999))
+	}
+}
+
+// oidcUsername derives an alphanumeric username from the claims of an external identity
+func oidcUsername(claims *oidc.Claims) string {
+	for _, candidate := range []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name} {
+		var username strings.Builder
+		for _, r := range candidate {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				username.WriteRune(r)
+			}
+		}
+		if username.Len() > 0 {
+			return strings.ToLower(username.String())[:min(username.Len(), maxUsernameLength)]
+		}
+	}
+	return "user"
+}
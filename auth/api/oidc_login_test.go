@@ -0,0 +1,138 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/oidc/oidctest"
+)
+
+func newOIDCTestServer(t *testing.T, store db.Store) (*Server, *oidctest.Issuer) {
+	issuer := oidctest.NewIssuer(t, "auth-client", "auth-secret")
+	config := testConfig()
+	config.PublicURL = "http://auth.example.com"
+	config.OIDCProviders = []string{"mock|" + issuer.URL + "|" + issuer.ClientID + "|" + issuer.ClientSecret}
+	server, err := NewServer(config, store, &testNotifier{})
+	require.NoError(t, err)
+	return server, issuer
+}
+
+// oidcSignIn runs the whole login through the mock issuer and returns the
+// response of the callback
+func oidcSignIn(t *testing.T, server *Server, withCookie bool) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/oidc/mock/login", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusFound, recorder.Code)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, oidcStateCookie, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	// the browser signs in at the issuer, which redirects back to us
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+	callback, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "auth.example.com", callback.Host)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	require.NoError(t, err)
+	if withCookie {
+		request.AddCookie(cookies[0])
+	}
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestOIDCLogin(t *testing.T) {
+	store := newMemoryStore()
+	server, issuer := newOIDCTestServer(t, store)
+	issuer.SetUser(oidctest.User{
+		Subject:       "1234",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice Liddell",
+	})
+
+	recorder := oidcSignIn(t, server, true)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var session loginUserResponse
+	decodeJSON(t, recorder, &session)
+	require.NotEmpty(t, session.AccessToken)
+	require.Equal(t, "alice", session.User.Username)
+	require.Equal(t, "Alice Liddell", session.User.Name)
+
+	payload, err := server.tokenMaker.VerifyToken(session.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", payload.Username)
+	require.True(t, store.users["alice"].EmailVerified)
+
+	// the next login finds the linked user instead of creating one
+	recorder = oidcSignIn(t, server, true)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &session)
+	require.Equal(t, "alice", session.User.Username)
+	require.Len(t, store.users, 1)
+	require.Len(t, store.identities, 1)
+
+	// a callback in a browser that did not start the login is refused
+	recorder = oidcSignIn(t, server, false)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/oidc/unknown/login", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	store := newMemoryStore()
+	server, issuer := newOIDCTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "carol", "carol@example.com").Code)
+	bob := store.users["bob"]
+	bob.EmailVerified = true
+	store.users["bob"] = bob
+
+	issuer.SetUser(oidctest.User{Subject: "bob-at-issuer", Email: "bob@example.com", EmailVerified: true})
+	recorder := oidcSignIn(t, server, true)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var session loginUserResponse
+	decodeJSON(t, recorder, &session)
+	require.Equal(t, "bob", session.User.Username)
+
+	// carol never verified her address, so whoever controls it at the issuer
+	// gets an account of their own
+	issuer.SetUser(oidctest.User{Subject: "carol-at-issuer", Email: "carol@example.com", EmailVerified: true})
+	recorder = oidcSignIn(t, server, true)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &session)
+	require.NotEqual(t, "carol", session.User.Username)
+	require.Contains(t, session.User.Username, "carol")
+	require.Equal(t, sql.NullString{}, store.users[session.User.Username].Email)
+
+	// addresses vouched for by the issuer are not verified again
+	require.Len(t, server.notifier.(*testNotifier).messages, 2)
+}
+
+func TestOIDCUsername(t *testing.T) {
+	require.Equal(t, "alice", oidcUsername(&oidc.Claims{PreferredUsername: "Alice"}))
+	require.Equal(t, "jdoe", oidcUsername(&oidc.Claims{Email: "j.doe@example.com"}))
+	require.Equal(t, "user", oidcUsername(&oidc.Claims{Name: "李"}))
+	require.Len(t, oidcUsername(&oidc.Claims{Name: "a very long name that goes on and on"}), maxUsernameLength)
+}
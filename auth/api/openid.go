@@ -0,0 +1,475 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// oidcScopes are the scopes third-party applications can ask users to consent to
+var oidcScopes = []string{token.ScopeOpenID, token.ScopeProfile, token.ScopeEmail}
+
+var (
+	errOpenIDDisabled     = errors.New("OpenID Connect requires asymmetric token keys")
+	errUnknownClient      = errors.New("unknown client")
+	errInvalidRedirectURI = errors.New("redirect URI is not registered for the client")
+	errInvalidGrant       = errors.New("authorization code is invalid or has expired")
+)
+
+// claimsSigner returns the signer of ID tokens. Without asymmetric keys
+// relying parties could not verify them, so the server is no provider then.
+func (server *Server) claimsSigner(ctx *gin.Context) (token.ClaimsSigner, bool) {
+	signer, ok := server.tokenMaker.(token.ClaimsSigner)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errOpenIDDisabled))
+		return nil, false
+	}
+	return signer, true
+}
+
+type openIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// getOpenIDConfiguration serves the discovery document of OpenID Connect Discovery 1.0
+func (server *Server) getOpenIDConfiguration(ctx *gin.Context) {
+	signer, ok := server.claimsSigner(ctx)
+	if !ok {
+		return
+	}
+	issuer := server.config.PublicURL
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, openIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oidcScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signer.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "name", "picture", "preferred_username", "email", "email_verified"},
+	})
+}
+
+// authorizationRequest is the request of a third-party application to sign a
+// user in, see RFC 6749 section 4.1.1. The consent page sends it back as JSON.
+type authorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// authorizationError is reported to the application on its redirect URI,
+// see RFC 6749 section 4.1.2.1
+type authorizationError struct {
+	code string
+	err  error
+}
+
+// authorizationClient returns the client of the request once its redirect URI
+// is known to be registered. Until then errors cannot be sent to the client.
+func (server *Server) authorizationClient(ctx *gin.Context, req authorizationRequest) (db.Client, bool) {
+	client, err := server.store.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errUnknownClient))
+			return db.Client{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Client{}, false
+	}
+	// redirect URIs are compared exactly, so codes cannot leak to another page
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidRedirectURI))
+		return db.Client{}, false
+	}
+	return client, true
+}
+
+// checkAuthorizationRequest returns the scopes the application asks for
+func checkAuthorizationRequest(client db.Client, req authorizationRequest) ([]string, *authorizationError) {
+	if req.ResponseType != "code" {
+		err := fmt.Errorf("unsupported response type %s", req.ResponseType)
+		return nil, &authorizationError{code: "unsupported_response_type", err: err}
+	}
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, token.ScopeOpenID) {
+		err := fmt.Errorf("the %s scope is required", token.ScopeOpenID)
+		return nil, &authorizationError{code: "invalid_scope", err: err}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(oidcScopes, scope) || !slices.Contains(client.Scopes, scope) {
+			err := fmt.Errorf("scope %s is not granted to the client", scope)
+			return nil, &authorizationError{code: "invalid_scope", err: err}
+		}
+	}
+	// every client must use PKCE, so a stolen code is useless on its own
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		err := errors.New("a S256 code challenge is required")
+		return nil, &authorizationError{code: "invalid_request", err: err}
+	}
+	return scopes, nil
+}
+
+// authorizationRedirect returns the redirect URI of the request with params
+// and the state of the application added to its query
+func authorizationRedirect(req authorizationRequest, params url.Values) string {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+	query := redirect.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+// authorize is where applications send users to sign in. Valid requests are
+// passed on to the consent page, which signs the user in and asks them to
+// approve the application.
+func (server *Server) authorize(ctx *gin.Context) {
+	if _, ok := server.claimsSigner(ctx); !ok {
+		return
+	}
+	var req authorizationRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	client, ok := server.authorizationClient(ctx, req)
+	if !ok {
+		return
+	}
+	if _, authErr := checkAuthorizationRequest(client, req); authErr != nil {
+		ctx.Redirect(http.StatusFound, authorizationRedirect(req, url.Values{
+			"error":             {authErr.code},
+			"error_description": {authErr.err.Error()},
+		}))
+		return
+	}
+
+	separator := "?"
+	if strings.Contains(server.config.ConsentURL, "?") {
+		separator = "&"
+	}
+	ctx.Redirect(http.StatusFound, server.config.ConsentURL+separator+ctx.Request.URL.RawQuery)
+}
+
+type consentResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+	// Granted is set when the user already consented to every scope, the
+	// consent page can then approve the request without asking again
+	Granted bool `json:"granted"`
+}
+
+// getConsent tells the consent page which application asks for what
+func (server *Server) getConsent(ctx *gin.Context) {
+	if _, ok := server.claimsSigner(ctx); !ok {
+		return
+	}
+	var req authorizationRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	client, ok := server.authorizationClient(ctx, req)
+	if !ok {
+		return
+	}
+	scopes, authErr := checkAuthorizationRequest(client, req)
+	if authErr != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(authErr.err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	granted, err := server.consentedScopes(ctx, authPayload.Username, client.ClientID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := consentResponse{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     scopes,
+		Granted:    true,
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			rsp.Granted = false
+		}
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// consentedScopes returns the scopes the user consented to for a client
+func (server *Server) consentedScopes(ctx *gin.Context, username string, clientID string) ([]string, error) {
+	consent, err := server.store.GetConsent(ctx, db.GetConsentParams{
+		Username: username,
+		ClientID: clientID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return consent.Scopes, nil
+}
+
+type consentRequest struct {
+	authorizationRequest
+	Approve bool `json:"approve"`
+}
+
+type consentDecisionResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// decideConsent records the decision of the user. Either way the consent page
+// sends the user back to the application, with an authorization code when approved.
+func (server *Server) decideConsent(ctx *gin.Context) {
+	if _, ok := server.claimsSigner(ctx); !ok {
+		return
+	}
+	var req consentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	client, ok := server.authorizationClient(ctx, req.authorizationRequest)
+	if !ok {
+		return
+	}
+	scopes, authErr := checkAuthorizationRequest(client, req.authorizationRequest)
+	if authErr != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(authErr.err))
+		return
+	}
+	if !req.Approve {
+		ctx.JSON(http.StatusOK, consentDecisionResponse{
+			RedirectTo: authorizationRedirect(req.authorizationRequest, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"the user denied the request"},
+			}),
+		})
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	granted, err := server.consentedScopes(ctx, authPayload.Username, client.ClientID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	_, err = server.store.UpsertConsent(ctx, db.UpsertConsentParams{
+		Username: authPayload.Username,
+		ClientID: client.ClientID,
+		Scopes:   granted,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	code, err := randomSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// codes that were never redeemed are dropped as new ones are issued
+	err = server.store.DeleteExpiredAuthorizationCodes(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.CreateAuthorizationCode(ctx, db.CreateAuthorizationCodeParams{
+		CodeHash:      hashToken(code),
+		ClientID:      client.ClientID,
+		Username:      authPayload.Username,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(server.config.AuthorizationCodeDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, consentDecisionResponse{
+		RedirectTo: authorizationRedirect(req.authorizationRequest, url.Values{"code": {code}}),
+	})
+}
+
+type authorizationCodeTokenResponse struct {
+	clientTokenResponse
+	IDToken string `json:"id_token"`
+}
+
+// redeemAuthorizationCode implements the OAuth2 authorization_code grant.
+// The application gets an ID token and an access token for the userinfo endpoint.
+func (server *Server) redeemAuthorizationCode(ctx *gin.Context, client db.Client, req tokenRequest) {
+	signer, ok := server.tokenMaker.(token.ClaimsSigner)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse("unsupported_grant_type", errOpenIDDisabled))
+		return
+	}
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		err := errors.New("code, redirect_uri and code_verifier are required")
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_request", err))
+		return
+	}
+	code, err := server.store.UseAuthorizationCode(ctx, hashToken(req.Code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_grant", errInvalidGrant))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+	if code.ClientID != client.ClientID || code.RedirectUri != req.RedirectURI ||
+		subtle.ConstantTimeCompare([]byte(oidc.CodeChallenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_grant", errInvalidGrant))
+		return
+	}
+	user, err := server.store.GetUser(ctx, code.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse("invalid_grant", errInvalidGrant))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.AccessTokenDuration,
+		token.ForClient(client.ClientID),
+		token.WithPermissions(code.Scopes),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+	claims := server.userClaims(user, code.Scopes)
+	claims.Audience = jwt.ClaimStrings{client.ClientID}
+	claims.IssuedAt = jwt.NewNumericDate(accessPayload.IssuedAt)
+	claims.ExpiresAt = jwt.NewNumericDate(accessPayload.ExpiredAt)
+	claims.Nonce = code.Nonce
+	idToken, err := signer.SignClaims(claims)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, authorizationCodeTokenResponse{
+		clientTokenResponse: clientTokenResponse{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(server.config.AccessTokenDuration.Seconds()),
+			Scope:       strings.Join(code.Scopes, " "),
+		},
+		IDToken: idToken,
+	})
+}
+
+// userClaims returns the claims about user that scopes give access to. The
+// subject is the ID of the user, which unlike the username never changes.
+func (server *Server) userClaims(user db.User, scopes []string) oidc.Claims {
+	claims := oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  server.config.PublicURL,
+			Subject: user.ID.String(),
+		},
+	}
+	if slices.Contains(scopes, token.ScopeProfile) {
+		claims.Name = user.Name
+		claims.Picture = user.Photo
+		claims.PreferredUsername = user.Username
+	}
+	if slices.Contains(scopes, token.ScopeEmail) && user.Email.Valid {
+		claims.Email = user.Email.String
+		claims.EmailVerified = user.EmailVerified
+	}
+	return claims
+}
+
+// getUserInfo returns the claims about the user of an access token issued
+// to an application, see OpenID Connect Core 1.0 section 5.3
+func (server *Server) getUserInfo(ctx *gin.Context) {
+	fields := strings.Fields(ctx.GetHeader(authorizationHeaderKey))
+	if len(fields) != 2 || strings.ToLower(fields[0]) != authorizationTypeBearer {
+		ctx.Header("WWW-Authenticate", `Bearer realm="userinfo"`)
+		ctx.JSON(http.StatusUnauthorized, oauthErrorResponse("invalid_request", errors.New("bearer token is required")))
+		return
+	}
+	payload, err := server.tokenMaker.VerifyToken(fields[1])
+	if err != nil || payload.ClientID == "" || !payload.HasPermission(token.ScopeOpenID) || server.revocations.IsRevoked(payload) {
+		ctx.Header("WWW-Authenticate", `Bearer realm="userinfo", error="invalid_token"`)
+		ctx.JSON(http.StatusUnauthorized, oauthErrorResponse("invalid_token", token.ErrInvalidToken))
+		return
+	}
+	user, err := server.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, oauthErrorResponse("invalid_token", token.ErrInvalidToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse("server_error", err))
+		return
+	}
+	claims := server.userClaims(user, payload.Permissions)
+	claims.Issuer = ""
+	ctx.JSON(http.StatusOK, claims)
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+const (
+	testAppRedirectURI = "http://app.example.com/callback"
+	testConsentURL     = "http://auth.example.com/consent"
+)
+
+// newOpenIDTestServer starts a server signing with an RSA key and registers
+// the "app" client users can sign in to
+func newOpenIDTestServer(t *testing.T, store *memoryStore) (*Server, *httptest.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	require.NoError(t, err)
+
+	// relying parties reach the server over HTTP, so the issuer is known only once it listens
+	var server *Server
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	config := testConfig()
+	config.TokenType = "jwt_asymmetric"
+	config.TokenPrivateKeyFile = keyFile
+	config.PublicURL = httpServer.URL
+	config.ConsentURL = testConsentURL
+	config.AuthorizationCodeDuration = config.AccessTokenDuration
+	server, err = NewServer(config, store, &testNotifier{})
+	require.NoError(t, err)
+
+	_, err = store.CreateClient(context.Background(), db.CreateClientParams{
+		ClientID:         "app",
+		ClientSecretHash: hashToken("app-secret"),
+		Scopes:           []string{token.ScopeOpenID, token.ScopeProfile, token.ScopeEmail},
+		Name:             "Example App",
+		RedirectUris:     []string{testAppRedirectURI},
+	})
+	require.NoError(t, err)
+	return server, httpServer
+}
+
+func loginTestUser(t *testing.T, server *Server, username string) string {
+	require.Equal(t, http.StatusOK, createTestUser(t, server, username, username+"@example.com").Code)
+	recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": username, "password": "secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var session loginUserResponse
+	decodeJSON(t, recorder, &session)
+	return session.AccessToken
+}
+
+func authorizationQuery(scope string, codeVerifier string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"app"},
+		"redirect_uri":          {testAppRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"state"},
+		"nonce":                 {"nonce"},
+		"code_challenge":        {oidc.CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// approveTestApp approves the authorization request on the consent page and
+// returns the query the user is sent back to the application with
+func approveTestApp(t *testing.T, server *Server, accessToken string, query url.Values, approve bool) url.Values {
+	body := gin.H{"approve": approve}
+	for key := range query {
+		body[key] = query.Get(key)
+	}
+	recorder := serveJSON(t, server, http.MethodPost, "/oauth/consent", body, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp consentDecisionResponse
+	decodeJSON(t, recorder, &rsp)
+	redirect, err := url.Parse(rsp.RedirectTo)
+	require.NoError(t, err)
+	require.Equal(t, testAppRedirectURI, redirect.Scheme+"://"+redirect.Host+redirect.Path)
+	require.Equal(t, "state", redirect.Query().Get("state"))
+	return redirect.Query()
+}
+
+func redeemTestCode(t *testing.T, server *Server, code string, codeVerifier string) *httptest.ResponseRecorder {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testAppRedirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("app", "app-secret")
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestOpenIDProvider(t *testing.T) {
+	store := newMemoryStore()
+	server, httpServer := newOpenIDTestServer(t, store)
+	accessToken := loginTestUser(t, server, "alice")
+	ctx := context.Background()
+
+	// the application only knows the issuer, the rest comes from discovery
+	relyingParty := oidc.NewProvider(utils.OIDCProvider{
+		Name:         "site",
+		Issuer:       httpServer.URL,
+		ClientID:     "app",
+		ClientSecret: "app-secret",
+	}, testAppRedirectURI)
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	authURL, err := relyingParty.AuthCodeURL(ctx, "state", "nonce", codeVerifier)
+	require.NoError(t, err)
+
+	// the user is passed on to the consent page
+	authRequest, err := url.Parse(authURL)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, authRequest.RequestURI(), nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusFound, recorder.Code)
+	consentPage, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(consentPage.String(), testConsentURL+"?"))
+	query := consentPage.Query()
+
+	recorder = serveJSON(t, server, http.MethodGet, "/oauth/consent?"+query.Encode(), nil, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var consent consentResponse
+	decodeJSON(t, recorder, &consent)
+	require.Equal(t, "Example App", consent.ClientName)
+	require.ElementsMatch(t, []string{token.ScopeOpenID, token.ScopeEmail, token.ScopeProfile}, consent.Scopes)
+	require.False(t, consent.Granted)
+
+	callback := approveTestApp(t, server, accessToken, query, true)
+	claims, err := relyingParty.Exchange(ctx, callback.Get("code"), codeVerifier, "nonce")
+	require.NoError(t, err)
+	require.Equal(t, store.users["alice"].ID.String(), claims.Subject)
+	require.Equal(t, "alice@example.com", claims.Email)
+	require.False(t, claims.EmailVerified)
+	require.Equal(t, "Test User", claims.Name)
+
+	// codes are single use
+	_, err = relyingParty.Exchange(ctx, callback.Get("code"), codeVerifier, "nonce")
+	require.Error(t, err)
+
+	// the next time the consent page does not need to ask
+	recorder = serveJSON(t, server, http.MethodGet, "/oauth/consent?"+query.Encode(), nil, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &consent)
+	require.True(t, consent.Granted)
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	store := newMemoryStore()
+	server, _ := newOpenIDTestServer(t, store)
+	accessToken := loginTestUser(t, server, "bob")
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+
+	callback := approveTestApp(t, server, accessToken, authorizationQuery("openid profile", codeVerifier), true)
+	code := callback.Get("code")
+	require.NotEmpty(t, code)
+
+	// the code is bound to the PKCE verifier of the application
+	otherVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	recorder := redeemTestCode(t, server, code, otherVerifier)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid_grant")
+
+	callback = approveTestApp(t, server, accessToken, authorizationQuery("openid profile", codeVerifier), true)
+	recorder = redeemTestCode(t, server, callback.Get("code"), codeVerifier)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp authorizationCodeTokenResponse
+	decodeJSON(t, recorder, &rsp)
+	require.NotEmpty(t, rsp.IDToken)
+	require.Equal(t, "openid profile", rsp.Scope)
+
+	// the access token reads the claims the user consented to
+	recorder = serveJSON(t, server, http.MethodGet, "/oauth/userinfo", nil, rsp.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var claims oidc.Claims
+	decodeJSON(t, recorder, &claims)
+	require.Equal(t, store.users["bob"].ID.String(), claims.Subject)
+	require.Equal(t, "bob", claims.PreferredUsername)
+	require.Empty(t, claims.Email)
+
+	// and nothing else
+	recorder = serveJSON(t, server, http.MethodGet, "/api-keys", nil, rsp.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodGet, "/oauth/userinfo", nil, accessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	callback = approveTestApp(t, server, accessToken, authorizationQuery("openid", codeVerifier), false)
+	require.Equal(t, "access_denied", callback.Get("error"))
+	require.Empty(t, callback.Get("code"))
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	store := newMemoryStore()
+	server, _ := newOpenIDTestServer(t, store)
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+
+	authorize := func(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// errors are only sent to redirect URIs registered for the client
+	query := authorizationQuery("openid", codeVerifier)
+	query.Set("redirect_uri", "http://attacker.example.com/callback")
+	recorder := authorize(t, query)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Location"))
+
+	query = authorizationQuery("openid", codeVerifier)
+	query.Set("client_id", "unknown")
+	recorder = authorize(t, query)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	testCases := []struct {
+		name  string
+		edit  func(query url.Values)
+		error string
+	}{
+		{
+			name:  "NoPKCE",
+			edit:  func(query url.Values) { query.Del("code_challenge") },
+			error: "invalid_request",
+		},
+		{
+			name:  "PlainPKCE",
+			edit:  func(query url.Values) { query.Set("code_challenge_method", "plain") },
+			error: "invalid_request",
+		},
+		{
+			name:  "NoOpenIDScope",
+			edit:  func(query url.Values) { query.Set("scope", "profile") },
+			error: "invalid_scope",
+		},
+		{
+			name:  "ServiceScope",
+			edit:  func(query url.Values) { query.Set("scope", "openid "+token.ScopeWriteBlog) },
+			error: "invalid_scope",
+		},
+		{
+			name:  "ImplicitFlow",
+			edit:  func(query url.Values) { query.Set("response_type", "token") },
+			error: "unsupported_response_type",
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			query := authorizationQuery("openid", codeVerifier)
+			tc.edit(query)
+			recorder := authorize(t, query)
+			require.Equal(t, http.StatusFound, recorder.Code)
+			redirect, err := url.Parse(recorder.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, "app.example.com", redirect.Host)
+			require.Equal(t, tc.error, redirect.Query().Get("error"))
+			require.Equal(t, "state", redirect.Query().Get("state"))
+		})
+	}
+}
+
+func TestOpenIDRequiresAsymmetricKeys(t *testing.T) {
+	server := NewTestServer(t, newMemoryStore())
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
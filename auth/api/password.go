@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+var errInvalidResetToken = errors.New("reset token is invalid or has expired")
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword mails a password reset link to the owner of an address.
+// The response is the same whether or not the address is registered, so it
+// cannot be used to find out who has an account.
+func (server *Server) forgotPassword(ctx *gin.Context) {
+	var req forgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, err := server.store.GetUserByEmail(ctx, sql.NullString{String: req.Email, Valid: true})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusAccepted, gin.H{})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.sendPasswordResetEmail(ctx, user.Username, user.Email.String)
+	if err != nil {
+		// failing here would tell the caller that the address is registered
+		log.Print("Can't send password reset email: ", err)
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
+
+// sendPasswordResetEmail mails a single use link that lets username choose a new password
+func (server *Server) sendPasswordResetEmail(ctx context.Context, username string, email string) error {
+	rawToken, err := server.createUserToken(ctx, username, userTokenResetPassword, email, server.config.PasswordResetDuration)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/password/reset?token=%s", server.config.PublicURL, url.QueryEscape(rawToken))
+	return server.notifier.Notify(ctx, notify.Message{
+		Type:    notify.TypePasswordReset,
+		Email:   email,
+		Links:   []string{link},
+		Summary: fmt.Sprintf("Someone asked to reset the password of your account %s. Open the link below to choose a new one.", username),
+	})
+}
+
+// validatePassword checks a new password of username against the password
+// policy, it answers with every rule the password breaks when it fails
+func (server *Server) validatePassword(ctx *gin.Context, username string, password string) bool {
+	err := server.passwordPolicy.Validate(password, username)
+	if err == nil {
+		return true
+	}
+	var policyErr *utils.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+	res := errorResponse(err)
+	res["violations"] = policyErr.Violations
+	ctx.JSON(http.StatusBadRequest, res)
+	return false
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// resetPassword sets a new password with a token from forgotPassword, signs
+// the user out everywhere and revokes their API keys
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	tokenParams := db.GetUserTokenParams{
+		TokenHash: hashToken(req.Token),
+		Purpose:   userTokenResetPassword,
+	}
+	userToken, err := server.store.GetUserToken(ctx, tokenParams)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	user, err := server.store.GetUser(ctx, userToken.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the link only proves access to the address it was sent to
+	if user.Email != userToken.Email {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidResetToken))
+		return
+	}
+	// a rejected password leaves the link usable for another try
+	if !server.validatePassword(ctx, user.Username, req.Password) {
+		return
+	}
+	_, err = server.store.UseUserToken(ctx, db.UseUserTokenParams(tokenParams))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	hashedPassword, err := server.passwordHasher.Hash(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.UpdatePassword(ctx, db.UpdatePasswordParams{
+		Username: user.Username,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.endUserSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.revocations.RevokeUser(ctx, user.Username, server.maxTokenLifetime())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.store.RevokeUserApiKeys(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
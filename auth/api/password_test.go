@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestResetPassword(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+
+	recorder := createTestUser(t, server, "alice", "alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	post := func(t *testing.T, path string, body gin.H) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	login := func(t *testing.T, password string) int {
+		recorder := httptest.NewRecorder()
+		data, err := json.Marshal(gin.H{"username": "alice", "password": password})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(data))
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusOK, login(t, "secret"))
+	require.Len(t, store.sessions, 1)
+
+	// unknown addresses get the same answer but no email
+	sent := len(notifier.messages)
+	recorder = post(t, "/password/forgot", gin.H{"email": "nobody@example.com"})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Len(t, notifier.messages, sent)
+
+	recorder = post(t, "/password/forgot", gin.H{"email": "alice@example.com"})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Len(t, notifier.messages, sent+1)
+	require.Equal(t, notify.TypePasswordReset, notifier.messages[sent].Type)
+	rawToken := lastLinkToken(t, server, "alice@example.com")
+
+	recorder = post(t, "/password/reset", gin.H{"token": "invalid", "password": "new-secret"})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// a verification link cannot be used to reset the password
+	verificationLink, err := url.Parse(notifier.messages[0].Links[0])
+	require.NoError(t, err)
+	recorder = post(t, "/password/reset", gin.H{"token": verificationLink.Query().Get("token"), "password": "new-secret"})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = post(t, "/password/reset", gin.H{"token": rawToken, "password": "new-secret"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	require.Equal(t, http.StatusUnauthorized, login(t, "secret"))
+	require.Equal(t, http.StatusOK, login(t, "new-secret"))
+	blocked := 0
+	for _, session := range store.sessions {
+		if session.IsBlocked {
+			blocked++
+		}
+	}
+	require.Equal(t, 1, blocked)
+
+	// reset tokens are single use
+	recorder = post(t, "/password/reset", gin.H{"token": rawToken, "password": "other-secret"})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestResetPasswordRevokesApiKeys(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+
+	recorder := serveJSON(t, server, http.MethodPost, "/password/forgot", gin.H{"email": "alice@example.com"}, "")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	rawToken := lastLinkToken(t, server, "alice@example.com")
+	require.Empty(t, store.apiKeysRevoked)
+
+	// whoever knew the old password may have created keys with it
+	recorder = serveJSON(t, server, http.MethodPost, "/password/reset", gin.H{"token": rawToken, "password": "new-secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, []string{"alice"}, store.apiKeysRevoked)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	config := testConfig()
+	config.PasswordMinLength = 10
+	config.PasswordMinCharacterClasses = 2
+	config.PasswordRejectUsername = true
+	config.PasswordCheckBreached = true
+	store := newMemoryStore()
+	server, err := NewServer(config, store, &testNotifier{})
+	require.NoError(t, err)
+
+	violations := func(t *testing.T, recorder *httptest.ResponseRecorder) []string {
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		var res struct {
+			Violations []utils.PasswordViolation `json:"violations"`
+		}
+		decodeJSON(t, recorder, &res)
+		codes := make([]string, len(res.Violations))
+		for i, violation := range res.Violations {
+			codes[i] = violation.Code
+		}
+		return codes
+	}
+	user := gin.H{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"name":     "Alice",
+		"about":    "about",
+		"photo":    "photo",
+		"password": "password",
+	}
+	recorder := serveJSON(t, server, http.MethodPost, "/", user, "")
+	require.Equal(t, []string{utils.PasswordTooShort, utils.PasswordTooSimple, utils.PasswordBreached}, violations(t, recorder))
+	user["password"] = "alice-in-wonderland"
+	recorder = serveJSON(t, server, http.MethodPost, "/", user, "")
+	require.Equal(t, []string{utils.PasswordSimilarUsername}, violations(t, recorder))
+	user["password"] = "correct-horse-battery"
+	recorder = serveJSON(t, server, http.MethodPost, "/", user, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	accessToken, _, err := server.tokenMaker.CreateToken("alice", "user", time.Minute)
+	require.NoError(t, err)
+	recorder = serveJSON(t, server, http.MethodPut, "/login", gin.H{"current_password": "correct-horse-battery", "password": "Qwerty123!"}, accessToken)
+	require.Equal(t, []string{utils.PasswordBreached}, violations(t, recorder))
+
+	// a rejected password does not use up the reset link
+	recorder = serveJSON(t, server, http.MethodPost, "/password/forgot", gin.H{"email": "alice@example.com"}, "")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	rawToken := lastLinkToken(t, server, "alice@example.com")
+	recorder = serveJSON(t, server, http.MethodPost, "/password/reset", gin.H{"token": rawToken, "password": "short"}, "")
+	require.Equal(t, []string{utils.PasswordTooShort, utils.PasswordTooSimple}, violations(t, recorder))
+	recorder = serveJSON(t, server, http.MethodPost, "/password/reset", gin.H{"token": rawToken, "password": "another-long-secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
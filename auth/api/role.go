@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"shivesh-ranjan.github.io/m/token"
 )
 
 type createRoleRequest struct {
@@ -17,12 +18,8 @@ func (server *Server) CreateRole(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	user, err := server.getUserFromPayload(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
-		return
-	}
-	if user.Role != "admin" {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageRoles) {
 		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can Create Roles")))
 		return
 	}
@@ -44,16 +41,12 @@ func (server *Server) DeleteRole(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	user, err := server.getUserFromPayload(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
-		return
-	}
-	if user.Role != "admin" {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageRoles) {
 		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can delete Roles")))
 		return
 	}
-	err = server.store.DeleteRole(ctx, req.Role)
+	err := server.store.DeleteRole(ctx, req.Role)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
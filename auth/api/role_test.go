@@ -0,0 +1,28 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleRequiresPermission(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			// the store is nil, so any database access would panic
+			server := NewTestServer(t, nil)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(method, "/role", bytes.NewBufferString(`{"role":"editor"}`))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", "user", time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+	}
+}
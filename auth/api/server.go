@@ -1,74 +1,247 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/revocation"
 	"shivesh-ranjan.github.io/m/token"
 	"shivesh-ranjan.github.io/m/utils"
 )
 
+// revocationSyncInterval is how often revocations are pruned and reloaded from the database
+const revocationSyncInterval = time.Minute
+
 // Server serves HTTP requests for our auth service
 type Server struct {
-	config     utils.Config
-	store      db.Store
-	tokenMaker token.Maker
-	router     *gin.Engine
+	config         utils.Config
+	store          db.Store
+	tokenMaker     token.Maker
+	revocations    *revocation.Store
+	notifier       notify.Notifier
+	oidcProviders  map[string]*oidc.Provider
+	passwordPolicy *utils.PasswordPolicy
+	passwordHasher *utils.PasswordHasher
+	sessionsSeen   *sessionsSeen
+	// dummyPasswordHash is checked for unknown users, so they take as long
+	// to reject as wrong passwords
+	dummyPasswordHash func() string
+	router            *gin.Engine
 }
 
-func NewServer(config utils.Config, store db.Store) (*Server, error) {
-	tokenMaker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+func NewServer(config utils.Config, store db.Store, notifier notify.Notifier) (*Server, error) {
+	tokenMaker, err := newTokenMaker(config)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create token maker: %w", err)
 	}
+	oidcProviders, err := newOIDCProviders(config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot configure OIDC providers: %w", err)
+	}
+	passwordPolicy, err := config.PasswordPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load password policy: %w", err)
+	}
+	passwordHasher, err := config.PasswordHasher()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create password hasher: %w", err)
+	}
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		revocations:    revocation.NewStore(store),
+		notifier:       notifier,
+		oidcProviders:  oidcProviders,
+		passwordPolicy: passwordPolicy,
+		passwordHasher: passwordHasher,
+		sessionsSeen:   newSessionsSeen(),
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, _ := passwordHasher.Hash(utils.RandomString(32))
+			return hash
+		}),
 	}
 	server.setupRouter()
 	return server, nil
 }
 
+// newTokenMaker picks the token implementation configured by TOKEN_TYPE
+func newTokenMaker(config utils.Config) (token.Maker, error) {
+	activeKey, verificationKeys, err := tokenKeys(config)
+	if err != nil {
+		return nil, err
+	}
+	options := []token.Option{
+		token.WithIssuer(config.TokenIssuer),
+		token.WithAudience(config.TokenAudience),
+	}
+	var tokenMaker token.Maker
+	switch config.TokenType {
+	case "", "jwt":
+		tokenMaker, err = token.NewJWTMaker(string(activeKey), options...)
+	case "paseto_local":
+		tokenMaker, err = token.NewPasetoLocalMaker(string(activeKey), options...)
+	case "paseto_public":
+		tokenMaker, err = token.NewPasetoPublicMaker(string(activeKey), options...)
+	case "jwt_asymmetric":
+		tokenMaker, err = token.NewAsymmetricJWTMaker(activeKey, options...)
+	default:
+		return nil, fmt.Errorf("unsupported token type %s", config.TokenType)
+	}
+	if err != nil || len(verificationKeys) == 0 {
+		return tokenMaker, err
+	}
+	return tokenMaker, tokenMaker.(token.KeyRotator).RotateKeys(activeKey, verificationKeys...)
+}
+
+// tokenKeys loads the signing key and the retired keys still accepted for verification
+func tokenKeys(config utils.Config) (activeKey []byte, verificationKeys [][]byte, err error) {
+	switch config.TokenType {
+	case "jwt_asymmetric":
+		activeKey, err = os.ReadFile(config.TokenPrivateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read private key: %w", err)
+		}
+		for _, file := range config.TokenVerificationKeyFiles {
+			key, err := os.ReadFile(file)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot read verification key: %w", err)
+			}
+			verificationKeys = append(verificationKeys, key)
+		}
+		return activeKey, verificationKeys, nil
+	case "paseto_public":
+		activeKey = []byte(config.TokenAsymmetricKey)
+	default:
+		activeKey = []byte(config.TokenSymmetricKey)
+	}
+	for _, key := range config.TokenVerificationKeys {
+		verificationKeys = append(verificationKeys, []byte(key))
+	}
+	return activeKey, verificationKeys, nil
+}
+
+// RotateKeys swaps the token keys for the ones in config without a restart.
+// Tokens signed with keys that are no longer configured stop being accepted.
+func (server *Server) RotateKeys(config utils.Config) error {
+	if config.TokenType != server.config.TokenType {
+		return errors.New("token type cannot change without a restart")
+	}
+	rotator, ok := server.tokenMaker.(token.KeyRotator)
+	if !ok {
+		return errors.New("token maker does not support key rotation")
+	}
+	activeKey, verificationKeys, err := tokenKeys(config)
+	if err != nil {
+		return err
+	}
+	return rotator.RotateKeys(activeKey, verificationKeys...)
+}
+
+// maxTokenLifetime is how long any token issued by the server stays valid
+func (server *Server) maxTokenLifetime() time.Duration {
+	if server.config.RefreshTokenDuration > server.config.AccessTokenDuration {
+		return server.config.RefreshTokenDuration
+	}
+	return server.config.AccessTokenDuration
+}
+
 func (server *Server) setupRouter() {
 	router := gin.Default()
 	router.Use(CORSMiddleware())
 
 	router.POST("/", server.createUser)
 	router.POST("/login", server.loginUser)
+	router.POST("/login/mfa", server.completeMFALogin)
+	router.POST("/login/mfa/enroll", server.enrollMFALogin)
+	router.POST("/login/magic-link", server.sendMagicLink)
+	router.GET("/login/magic-link/verify", server.verifyMagicLink)
+	router.GET("/oidc/:provider/login", server.oidcLogin)
+	router.GET("/oidc/:provider/callback", server.oidcCallback)
+	router.POST("/tokens/renew_access", server.renewAccessToken)
 	router.GET("/", server.getUser)
+	router.GET("/.well-known/jwks.json", server.getJWKS)
+	router.GET("/.well-known/openid-configuration", server.getOpenIDConfiguration)
+	router.GET("/oauth/authorize", server.authorize)
+	router.GET("/oauth/userinfo", server.getUserInfo)
+	router.POST("/oauth/userinfo", server.getUserInfo)
+	router.POST("/oauth/introspect", server.introspectToken)
+	router.POST("/oauth/token", server.issueToken)
+	router.GET("/verify-email", server.verifyEmail)
+	router.POST("/password/forgot", server.forgotPassword)
+	router.POST("/password/reset", server.resetPassword)
 
 	// ======================================================
-	router.GET("/blog/*proxyPath", func(ctx *gin.Context) {
+	// signed in users, and admins impersonating them, see the blog as themselves
+	router.GET("/blog/*proxyPath", optionalAuth(authMiddleware(server.tokenMaker, server.revocations, server.verifyApiKey, server.touchSession)), func(ctx *gin.Context) {
 		targetURL := server.config.BlogMicroURL
-		proxyRequest(ctx, targetURL, "")
+		var authPayload *token.Payload
+		if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+			authPayload = payload.(*token.Payload)
+		}
+		proxyRequest(ctx, targetURL, authPayload)
 	})
 	// ======================================================
 
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
-	authRoutes.POST("/role", server.CreateRole)
-	authRoutes.DELETE("/role", server.DeleteRole)
-	authRoutes.PUT("/", server.UpdateUser)
-	authRoutes.PUT("/role", server.UpdateRole)
-	authRoutes.PUT("/login", server.UpdatePassword)
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.revocations, nil, server.touchSession))
+	authRoutes.PUT("/login", requireUser(), server.UpdatePassword)
+	authRoutes.PUT("/username", requireUser(), server.changeUsername)
+	authRoutes.DELETE("/", requireUser(), server.deleteAccount)
+	authRoutes.POST("/logout", server.logoutUser)
+	authRoutes.GET("/sessions", requireUser(), server.listSessions)
+	authRoutes.GET("/me/logins", requireUser(), server.listLoginHistory)
+	authRoutes.GET("/me/export", requireUser(), server.exportAccount)
+	authRoutes.DELETE("/sessions", requireUser(), server.deleteOtherSessions)
+	authRoutes.DELETE("/sessions/:id", requireUser(), server.deleteSession)
+	authRoutes.POST("/verify-email", requireUser(), server.resendVerificationEmail)
+	authRoutes.POST("/mfa/enroll", requireUser(), server.enrollUserTotp)
+	authRoutes.POST("/mfa/confirm", requireUser(), server.confirmUserTotp)
+	authRoutes.POST("/mfa/disable", requireUser(), server.disableUserTotp)
+	authRoutes.POST("/tokens/exchange", requireUser(), server.exchangeToken)
+	authRoutes.GET("/oauth/consent", requireUser(), server.getConsent)
+	authRoutes.POST("/oauth/consent", requireUser(), server.decideConsent)
+	authRoutes.POST("/api-keys", requireUser(), server.createApiKey)
+	authRoutes.GET("/api-keys", requireUser(), server.listApiKeys)
+	authRoutes.DELETE("/api-keys/:id", requireUser(), server.revokeApiKey)
+	authRoutes.POST("/admin/impersonate", requireUser(), server.impersonateUser)
+	authRoutes.GET("/admin/impersonations", server.listImpersonations)
+
+	// routes that scripts can also call with an API key and services with their client token
+	apiKeyRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.revocations, server.verifyApiKey, server.touchSession))
+	apiKeyRoutes.POST("/role", server.CreateRole)
+	apiKeyRoutes.DELETE("/role", server.DeleteRole)
+	apiKeyRoutes.PUT("/", requireUser(), requireScope(token.ScopeWriteProfile), server.UpdateUser)
+	apiKeyRoutes.PUT("/role", server.UpdateRole)
+	apiKeyRoutes.POST("/admin/keys/rotate", server.rotateKeys)
+	apiKeyRoutes.POST("/admin/revoke", server.revokeUserTokens)
+	apiKeyRoutes.POST("/admin/mfa", server.requireMFA)
+	apiKeyRoutes.POST("/admin/unlock", server.unlockLogin)
+	apiKeyRoutes.POST("/admin/clients", server.createClient)
 
 	// ======================================================
-	authRoutes.POST("/blog/*proxyPath", func(ctx *gin.Context) {
+	apiKeyRoutes.POST("/blog/*proxyPath", requireScope(token.ScopeWriteBlog), func(ctx *gin.Context) {
 		targetURL := server.config.BlogMicroURL
-		user, _ := server.getUserFromPayload(ctx)
-		proxyRequest(ctx, targetURL, user.Username)
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		proxyRequest(ctx, targetURL, authPayload)
 	})
-	authRoutes.PUT("/blog/*proxyPath", func(ctx *gin.Context) {
+	apiKeyRoutes.PUT("/blog/*proxyPath", requireScope(token.ScopeWriteBlog), func(ctx *gin.Context) {
 		targetURL := server.config.BlogMicroURL
-		user, _ := server.getUserFromPayload(ctx)
-		proxyRequest(ctx, targetURL, user.Username)
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		proxyRequest(ctx, targetURL, authPayload)
 	})
-	authRoutes.DELETE("/blog/*proxyPath", func(ctx *gin.Context) {
+	apiKeyRoutes.DELETE("/blog/*proxyPath", requireScope(token.ScopeWriteBlog), func(ctx *gin.Context) {
 		targetURL := server.config.BlogMicroURL
-		user, _ := server.getUserFromPayload(ctx)
-		proxyRequest(ctx, targetURL, user.Username)
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		proxyRequest(ctx, targetURL, authPayload)
 	})
 	// ======================================================
 
@@ -77,6 +250,8 @@ func (server *Server) setupRouter() {
 
 // Start runs the HTTP Server on a specific address
 func (server *Server) Start(address string) error {
+	go server.revocations.Run(context.Background(), revocationSyncInterval)
+	go server.runAccountPurge(context.Background(), accountPurgeInterval)
 	return server.router.Run(address)
 }
 
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// sessionLastSeenResolution limits how often requests of a session write to the database
+const sessionLastSeenResolution = time.Minute
+
+// userAgentBrowsers and userAgentSystems are matched in order, so the more
+// specific names come before the ones they also contain, like Edge before Chrome
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// deviceName describes the device behind a user agent coarsely, like "Firefox on Linux"
+func deviceName(userAgent string) string {
+	browser, system := "Unknown browser", ""
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	for _, candidate := range userAgentSystems {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func newSessionResponse(session db.Session, authPayload *token.Payload) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		Device:     deviceName(session.UserAgent),
+		ClientIP:   session.ClientIp,
+		UserAgent:  session.UserAgent,
+		Current:    isCurrentSession(session, authPayload),
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
+
+// isCurrentSession reports whether the token of the request was issued for session
+func isCurrentSession(session db.Session, authPayload *token.Payload) bool {
+	return authPayload.SessionID != nil && *authPayload.SessionID == session.ID
+}
+
+// listSessions shows the caller where they are signed in, most recently used first
+func (server *Server) listSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	sessions, err := server.store.ListUserSessions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		rsp = append(rsp, newSessionResponse(session, authPayload))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// endSession blocks a session so it can no longer be renewed and revokes the
+// tokens issued for it
+func (server *Server) endSession(ctx *gin.Context, session db.Session) error {
+	err := server.store.BlockSession(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	return server.revocations.RevokeSession(ctx, session)
+}
+
+// endUserSessions ends every session of username. Unlike a user wide
+// revocation it also catches the tokens issued within the current second.
+func (server *Server) endUserSessions(ctx *gin.Context, username string) error {
+	sessions, err := server.store.ListUserSessions(ctx, username)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := server.endSession(ctx, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type deleteSessionRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// deleteSession signs one of the devices of the caller out
+func (server *Server) deleteSession(ctx *gin.Context) {
+	var req deleteSessionRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	session, err := server.store.GetSession(ctx, uuid.MustParse(req.ID))
+	if err == nil && session.Username != authPayload.Username {
+		// sessions of other users do not exist as far as the caller knows
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if err := server.endSession(ctx, session); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newSessionResponse(session, authPayload))
+}
+
+// endOtherSessions ends every session of the caller but the one of the
+// request and returns the sessions it ended
+func (server *Server) endOtherSessions(ctx *gin.Context, authPayload *token.Payload) ([]db.Session, error) {
+	sessions, err := server.store.ListUserSessions(ctx, authPayload.Username)
+	if err != nil {
+		return nil, err
+	}
+	ended := []db.Session{}
+	for _, session := range sessions {
+		if isCurrentSession(session, authPayload) {
+			continue
+		}
+		if err := server.endSession(ctx, session); err != nil {
+			return nil, err
+		}
+		ended = append(ended, session)
+	}
+	return ended, nil
+}
+
+// deleteOtherSessions signs the caller out everywhere but on the device making the request
+func (server *Server) deleteOtherSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	sessions, err := server.endOtherSessions(ctx, authPayload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		rsp = append(rsp, newSessionResponse(session, authPayload))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// sessionsSeen remembers when the sessions of this replica were last marked
+// as seen, so that each is written at most once per sessionLastSeenResolution
+type sessionsSeen struct {
+	mu   sync.Mutex
+	seen map[uuid.UUID]time.Time
+}
+
+func newSessionsSeen() *sessionsSeen {
+	return &sessionsSeen{seen: make(map[uuid.UUID]time.Time)}
+}
+
+// due reports whether id was not marked within the resolution and marks it if so
+func (sessions *sessionsSeen) due(id uuid.UUID, now time.Time) bool {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	if now.Sub(sessions.seen[id]) <= sessionLastSeenResolution {
+		return false
+	}
+	// sessions that went quiet would pile up otherwise
+	for seenID, seenAt := range sessions.seen {
+		if now.Sub(seenAt) > sessionLastSeenResolution {
+			delete(sessions.seen, seenID)
+		}
+	}
+	sessions.seen[id] = now
+	return true
+}
+
+// touchSession updates when the session was last seen, a failure does not
+// fail the request it was seen with
+func (server *Server) touchSession(ctx *gin.Context, sessionID uuid.UUID) {
+	if !server.sessionsSeen.due(sessionID, time.Now()) {
+		return
+	}
+	if err := server.store.TouchSession(ctx, sessionID); err != nil {
+		log.Print("Can't update when the session was last seen: ", err)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	firefoxLinux  = "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	safariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1"
+	edgeWindows   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0"
+	chromeAndroid = "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36"
+)
+
+func TestDeviceName(t *testing.T) {
+	require.Equal(t, "Firefox on Linux", deviceName(firefoxLinux))
+	require.Equal(t, "Safari on iOS", deviceName(safariIPhone))
+	require.Equal(t, "Edge on Windows", deviceName(edgeWindows))
+	require.Equal(t, "Chrome on Android", deviceName(chromeAndroid))
+	require.Equal(t, "curl", deviceName("curl/8.5.0"))
+	require.Equal(t, "Unknown browser", deviceName(""))
+}
+
+// loginWithUserAgent signs username in from a device
+func loginWithUserAgent(t *testing.T, server *Server, username string, userAgent string) loginUserResponse {
+	body, err := json.Marshal(gin.H{"username": username, "password": "secret"})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	request.Header.Set("User-Agent", userAgent)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp loginUserResponse
+	decodeJSON(t, recorder, &rsp)
+	return rsp
+}
+
+func TestSessions(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	laptop := loginWithUserAgent(t, server, "alice", firefoxLinux)
+	phone := loginWithUserAgent(t, server, "alice", safariIPhone)
+	tablet := loginWithUserAgent(t, server, "alice", chromeAndroid)
+	bob := loginWithUserAgent(t, server, "bob", edgeWindows)
+
+	listSessions := func(accessToken string) []sessionResponse {
+		recorder := serveJSON(t, server, http.MethodGet, "/sessions", nil, accessToken)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var sessions []sessionResponse
+		decodeJSON(t, recorder, &sessions)
+		return sessions
+	}
+	renew := func(session loginUserResponse) int {
+		return serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": session.RefreshToken}, "").Code
+	}
+
+	sessions := listSessions(laptop.AccessToken)
+	require.Len(t, sessions, 3)
+	devices := map[string]sessionResponse{}
+	for _, session := range sessions {
+		devices[session.Device] = session
+	}
+	require.True(t, devices["Firefox on Linux"].Current)
+	require.Equal(t, laptop.SessionID, devices["Firefox on Linux"].ID)
+	require.False(t, devices["Safari on iOS"].Current)
+	require.Equal(t, safariIPhone, devices["Safari on iOS"].UserAgent)
+
+	// the sessions of other users cannot be ended
+	recorder := serveJSON(t, server, http.MethodDelete, "/sessions/"+bob.SessionID.String(), nil, laptop.AccessToken)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodDelete, "/sessions/not-a-uuid", nil, laptop.AccessToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// a renewed token belongs to its session as well
+	require.Equal(t, http.StatusOK, renew(phone))
+	recorder = serveJSON(t, server, http.MethodDelete, "/sessions/"+phone.SessionID.String(), nil, laptop.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusUnauthorized, serveJSON(t, server, http.MethodGet, "/sessions", nil, phone.AccessToken).Code)
+	require.Equal(t, http.StatusUnauthorized, renew(phone))
+	require.Len(t, listSessions(laptop.AccessToken), 2)
+
+	second := loginWithUserAgent(t, server, "alice", edgeWindows)
+	recorder = serveJSON(t, server, http.MethodDelete, "/sessions", nil, laptop.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var ended []sessionResponse
+	decodeJSON(t, recorder, &ended)
+	require.Len(t, ended, 2)
+	for _, session := range []loginUserResponse{tablet, second} {
+		require.Equal(t, http.StatusUnauthorized, serveJSON(t, server, http.MethodGet, "/sessions", nil, session.AccessToken).Code)
+		require.Equal(t, http.StatusUnauthorized, renew(session))
+	}
+
+	// the caller and other users stay signed in
+	sessions = listSessions(laptop.AccessToken)
+	require.Len(t, sessions, 1)
+	require.True(t, sessions[0].Current)
+	require.Equal(t, http.StatusOK, renew(laptop))
+	require.Len(t, listSessions(bob.AccessToken), 1)
+}
+
+func TestSessionLastSeen(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	session := loginWithUserAgent(t, server, "alice", firefoxLinux)
+	lastSeen := func() time.Time {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return store.sessions[session.SessionID].LastSeenAt
+	}
+
+	// using an access token marks its session as seen
+	signedIn := lastSeen()
+	require.Equal(t, http.StatusOK, serveJSON(t, server, http.MethodGet, "/sessions", nil, session.AccessToken).Code)
+	seen := lastSeen()
+	require.True(t, seen.After(signedIn))
+
+	// but not on every request
+	require.Equal(t, http.StatusOK, serveJSON(t, server, http.MethodGet, "/sessions", nil, session.AccessToken).Code)
+	require.Equal(t, seen, lastSeen())
+
+	server.sessionsSeen.seen[session.SessionID] = time.Now().Add(-sessionLastSeenResolution - time.Second)
+	require.Equal(t, http.StatusOK, serveJSON(t, server, http.MethodGet, "/sessions", nil, session.AccessToken).Code)
+	require.True(t, lastSeen().After(seen))
+}
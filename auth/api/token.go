@@ -0,0 +1,210 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+var errNotRefreshToken = errors.New("not a refresh token")
+
+type renewAccessTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type renewAccessTokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+}
+
+func (server *Server) renewAccessToken(ctx *gin.Context) {
+	var req renewAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	if refreshPayload.Purpose != token.PurposeRefresh {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errNotRefreshToken))
+		return
+	}
+	// revoking all tokens of a user also blocks the sessions checked below
+	if server.revocations.IsTokenRevoked(refreshPayload.ID) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errRevokedToken))
+		return
+	}
+	session, err := server.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if session.IsBlocked {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("blocked session")))
+		return
+	}
+	if session.Username != refreshPayload.Username {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("incorrect session user")))
+		return
+	}
+	if session.RefreshToken != req.RefreshToken {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("mismatched session token")))
+		return
+	}
+	if time.Now().After(session.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("expired session")))
+		return
+	}
+	// the role is read again so that renewed tokens pick up role changes
+	user, err := server.store.GetUser(ctx, session.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.AccessTokenDuration,
+		token.ForSession(session.ID),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.store.TouchSession(ctx, session.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := renewAccessTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// getJWKS publishes the public keys so other services can verify our tokens locally
+func (server *Server) getJWKS(ctx *gin.Context) {
+	jwks := token.JSONWebKeySet{Keys: []token.JSONWebKey{}}
+	if provider, ok := server.tokenMaker.(token.KeySetProvider); ok {
+		jwks = provider.JWKS()
+	}
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, jwks)
+}
+
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// logoutUser revokes the access token of the request and, when given, the
+// refresh token of the session so it can no longer be renewed
+func (server *Server) logoutUser(ctx *gin.Context) {
+	var req logoutRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if req.RefreshToken != "" {
+		refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		if refreshPayload.Purpose != token.PurposeRefresh {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errNotRefreshToken))
+			return
+		}
+		if refreshPayload.Username != authPayload.Username {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("incorrect session user")))
+			return
+		}
+		err = server.store.BlockSession(ctx, refreshPayload.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		err = server.revocations.RevokeToken(ctx, refreshPayload)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	err := server.revocations.RevokeToken(ctx, authPayload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+type exchangeTokenRequest struct {
+	Audience string `json:"audience" binding:"required"`
+}
+
+type exchangeTokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	Audience             string    `json:"audience"`
+}
+
+// exchangeToken turns the gateway token of the request into a short lived
+// token that only the named downstream service accepts
+func (server *Server) exchangeToken(ctx *gin.Context) {
+	var req exchangeTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !slices.Contains(server.config.TokenExchangeAudiences, req.Audience) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("unknown audience %s", req.Audience)))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// the exchanged token never outlives the one it was exchanged for
+	duration := server.config.ServiceTokenDuration
+	if remaining := time.Until(authPayload.ExpiredAt); !authPayload.NeverExpires && remaining < duration {
+		duration = remaining
+	}
+	options := []token.PayloadOption{
+		token.ForAudience(req.Audience),
+		token.WithPermissions([]string{}),
+	}
+	if authPayload.SessionID != nil {
+		options = append(options, token.ForSession(*authPayload.SessionID))
+	}
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		authPayload.Username,
+		authPayload.Role,
+		duration,
+		options...,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := exchangeTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		Audience:             accessPayload.Audience,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestGetJWKS(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	require.NoError(t, err)
+
+	config := utils.Config{
+		TokenType:           "jwt_asymmetric",
+		TokenPrivateKeyFile: keyFile,
+		AccessTokenDuration: time.Minute,
+	}
+	server, err := NewServer(config, nil, &testNotifier{})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var jwks token.JSONWebKeySet
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, "OKP", jwks.Keys[0].Kty)
+	require.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	require.NotEmpty(t, jwks.Keys[0].Kid)
+}
+
+func TestExchangeToken(t *testing.T) {
+	server := NewTestServer(t, nil)
+
+	exchange := func(t *testing.T, audience string, setupAuth func(request *http.Request)) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"audience":%q}`, audience)
+		request, err := http.NewRequest(http.MethodPost, "/tokens/exchange", strings.NewReader(body))
+		require.NoError(t, err)
+		setupAuth(request)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	gatewayAuth := func(request *http.Request) {
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", "admin", time.Minute)
+	}
+
+	recorder := exchange(t, "blog", gatewayAuth)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var rsp exchangeTokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+	require.Equal(t, "blog", rsp.Audience)
+	require.WithinDuration(t, time.Now().Add(time.Minute), rsp.AccessTokenExpiresAt, 2*time.Second)
+
+	// the blog token is not accepted by the gateway itself
+	_, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.EqualError(t, err, token.ErrInvalidToken.Error())
+	recorder = exchange(t, "blog", func(request *http.Request) {
+		request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+rsp.AccessToken)
+	})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = exchange(t, "unknown", gatewayAuth)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestRenewAccessToken(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	laptop := loginWithUserAgent(t, server, "alice", firefoxLinux)
+	phone := loginWithUserAgent(t, server, "alice", safariIPhone)
+	tablet := loginWithUserAgent(t, server, "alice", chromeAndroid)
+	bob := loginWithUserAgent(t, server, "bob", edgeWindows)
+
+	renew := func(refreshToken string) *httptest.ResponseRecorder {
+		return serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": refreshToken}, "")
+	}
+
+	recorder := renew(laptop.RefreshToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp renewAccessTokenResponse
+	decodeJSON(t, recorder, &rsp)
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", payload.Username)
+	require.Equal(t, &laptop.SessionID, payload.SessionID)
+	require.Empty(t, payload.Purpose)
+	require.Equal(t, http.StatusOK, serveJSON(t, server, http.MethodGet, "/sessions", nil, rsp.AccessToken).Code)
+
+	// access and refresh tokens are not interchangeable
+	require.Equal(t, http.StatusUnauthorized, renew(laptop.AccessToken).Code)
+	require.Equal(t, http.StatusUnauthorized, serveJSON(t, server, http.MethodGet, "/sessions", nil, laptop.RefreshToken).Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/logout", gin.H{"refresh_token": laptop.AccessToken}, laptop.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// a session ended from another device
+	recorder = serveJSON(t, server, http.MethodDelete, "/sessions/"+phone.SessionID.String(), nil, laptop.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusUnauthorized, renew(phone.RefreshToken).Code)
+
+	// a session blocked in the database
+	session := store.sessions[tablet.SessionID]
+	session.IsBlocked = true
+	store.sessions[tablet.SessionID] = session
+	require.Equal(t, http.StatusUnauthorized, renew(tablet.RefreshToken).Code)
+
+	// a session that belongs to someone else than the token
+	session = store.sessions[bob.SessionID]
+	session.Username = "alice"
+	store.sessions[bob.SessionID] = session
+	require.Equal(t, http.StatusUnauthorized, renew(bob.RefreshToken).Code)
+}
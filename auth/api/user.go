@@ -1,22 +1,27 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 	db "shivesh-ranjan.github.io/m/db/sqlc"
-	"shivesh-ranjan.github.io/m/utils"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/token"
 )
 
 type createUserRequest struct {
 	Username string `json:"username" binding:"required,alphanum"`
+	Email    string `json:"email" binding:"required,email"`
 	Name     string `json:"name" binding:"required"`
-	Password string `json:"password" binding:"required,min=5"`
+	Password string `json:"password" binding:"required"`
 	About    string `json:"about" binding:"required"`
 	Photo    string `json:"photo" binding:"required"`
 }
@@ -36,7 +41,19 @@ func (server *Server) createUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	hashedPassword, perror := utils.HashPassword(req.Password)
+	reserved, err := server.usernameReserved(ctx, req.Username, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if reserved {
+		ctx.JSON(http.StatusForbidden, errorResponse(errUsernameReserved))
+		return
+	}
+	if !server.validatePassword(ctx, req.Username, req.Password) {
+		return
+	}
+	hashedPassword, perror := server.passwordHasher.Hash(req.Password)
 	if perror != nil {
 		ctx.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("There was a problem while parsing the password")))
 		return
@@ -48,6 +65,7 @@ func (server *Server) createUser(ctx *gin.Context) {
 		About:    req.About,
 		Password: hashedPassword,
 		Photo:    req.Photo,
+		Email:    sql.NullString{String: req.Email, Valid: true},
 	}
 	result, err := server.store.CreateUser(ctx, arg)
 	if err != nil {
@@ -57,6 +75,10 @@ func (server *Server) createUser(ctx *gin.Context) {
 				ctx.JSON(http.StatusForbidden, errorResponse(err))
 				return
 			case "unique_violation":
+				if pqErr.Constraint == "users_email_key" {
+					ctx.JSON(http.StatusForbidden, errorResponse(errors.New("email already registered.")))
+					return
+				}
 				ctx.JSON(http.StatusForbidden, errorResponse(errors.New("username already taken.")))
 				return
 			}
@@ -64,6 +86,11 @@ func (server *Server) createUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	// the account exists either way, a lost email can be sent again from POST /verify-email
+	err = server.sendVerificationEmail(ctx, result.Username, req.Email)
+	if err != nil {
+		log.Print("Can't send verification email: ", err)
+	}
 	res := UserResponse{
 		Name:      result.Name,
 		Username:  result.Username,
@@ -86,6 +113,14 @@ func (server *Server) getUser(ctx *gin.Context) {
 		return
 	}
 	user, err := server.store.GetUser(ctx, req.Username)
+	if err == sql.ErrNoRows {
+		// links to a renamed user keep working while the old name is reserved
+		var reservation db.UsernameChange
+		reservation, err = server.store.GetUsernameReservation(ctx, req.Username)
+		if err == nil {
+			user, err = server.store.GetUser(ctx, reservation.Username)
+		}
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
@@ -106,29 +141,69 @@ func (server *Server) getUser(ctx *gin.Context) {
 }
 
 type updatePasswordRequest struct {
-	Password string `json:"password" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required"`
 }
 
+// UpdatePassword changes the password of the caller, who has to know the
+// current one. The session of the request carries on, every other session
+// and the API keys of the user are revoked.
 func (server *Server) UpdatePassword(ctx *gin.Context) {
 	var req updatePasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	user, err := server.getUserFromPayload(ctx)
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !server.confirmPassword(ctx, user, req.CurrentPassword) {
+		return
+	}
+	if !server.validatePassword(ctx, user.Username, req.Password) {
+		return
+	}
+	hashedPassword, err := server.passwordHasher.Hash(req.Password)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
-	arg := db.UpdatePasswordParams{
+	user, err = server.store.UpdatePassword(ctx, db.UpdatePasswordParams{
 		Username: user.Username,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
 	}
-	arg.Password, _ = utils.HashPassword(req.Password)
-	user, err = server.store.UpdatePassword(ctx, arg)
+	// the caller stays signed in, every other device has to sign in again
+	_, err = server.endOtherSessions(ctx, authPayload)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	err = server.store.RevokeUserApiKeys(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.Email.Valid {
+		err = server.notifier.Notify(ctx, notify.Message{
+			Type:    notify.TypePasswordChanged,
+			Email:   user.Email.String,
+			Summary: fmt.Sprintf("The password of your account %s was changed and every other device was signed out.", user.Username),
+		})
+		if err != nil {
+			log.Print("Can't send password changed email: ", err)
+		}
+	}
 	res := UserResponse{
 		Name:      user.Name,
 		Username:  user.Username,
@@ -151,12 +226,8 @@ func (server *Server) UpdateRole(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	user, err := server.getUserFromPayload(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
-		return
-	}
-	if user.Role != "admin" {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !authPayload.HasPermission(token.PermissionManageUsers) {
 		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Only admins can update Role.")))
 		return
 	}
@@ -164,7 +235,13 @@ func (server *Server) UpdateRole(ctx *gin.Context) {
 		Username: req.Username,
 		Role:     req.Role,
 	}
-	user, err = server.store.UpdateRole(ctx, arg)
+	user, err := server.store.UpdateRole(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// tokens carry the role, so the ones issued so far must be renewed to pick up the new one
+	err = server.revocations.RevokeUser(ctx, user.Username, server.maxTokenLifetime())
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
@@ -192,18 +269,14 @@ func (server *Server) UpdateUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	user, err := server.getUserFromPayload(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
-		return
-	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 	arg := db.UpdateUserParams{
-		Username: user.Username,
+		Username: authPayload.Username,
 		Name:     req.Name,
 		About:    req.About,
 		Photo:    req.Photo,
 	}
-	user, err = server.store.UpdateUser(ctx, arg)
+	user, err := server.store.UpdateUser(ctx, arg)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
@@ -225,8 +298,12 @@ type loginUserRequest struct {
 }
 
 type loginUserResponse struct {
-	AccessToken string       `json:"access_token"`
-	User        UserResponse `json:"user"`
+	SessionID             uuid.UUID    `json:"session_id"`
+	AccessToken           string       `json:"access_token"`
+	AccessTokenExpiresAt  time.Time    `json:"access_token_expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time    `json:"refresh_token_expires_at"`
+	User                  UserResponse `json:"user"`
 }
 
 func (server *Server) loginUser(ctx *gin.Context) {
@@ -235,25 +312,124 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
+	lockedFor, err := server.loginLockedFor(ctx, req.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if lockedFor > 0 {
+		rejectLockedLogin(ctx, lockedFor)
+		return
+	}
 	user, err := server.store.GetUser(ctx, req.Username)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// unknown users and wrong passwords look the same, so usernames cannot be enumerated
+	hashedPassword := user.Password
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		hashedPassword = server.dummyPasswordHash()
+	}
+	if server.passwordHasher.Check(req.Password, hashedPassword) != nil || err != nil {
+		if err := server.recordLoginFailure(ctx, req.Username); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		// only existing users have a login history
+		if err == nil {
+			if err := server.recordLogin(ctx, user, false); err != nil {
+				ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+				return
+			}
+		}
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidCredentials))
 		return
 	}
-	err = utils.CheckPassword(req.Password, user.Password)
-	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+	if server.passwordHasher.NeedsRehash(user.Password) {
+		go server.rehashPassword(user, req.Password)
+	}
+	// with two-factor authentication the password only earns an mfa_pending token
+	if user.TotpEnabled || user.MfaRequired {
+		server.startMFALogin(ctx, user)
 		return
 	}
-	accessToken, err := server.tokenMaker.CreateToken(user.Username, server.config.AccessTokenDuration)
+	rsp, err := server.createSession(ctx, user)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	if err := server.recordLogin(ctx, user, true); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// rehashPassword replaces the outdated password hash of user with one made
+// with the current settings, unless the password changed in the meantime
+func (server *Server) rehashPassword(user db.User, password string) {
+	hashedPassword, err := server.passwordHasher.Hash(password)
+	if err != nil {
+		log.Print("Can't rehash password: ", err)
+		return
+	}
+	err = server.store.RehashPassword(context.Background(), db.RehashPasswordParams{
+		NewPassword: hashedPassword,
+		Username:    user.Username,
+		OldPassword: user.Password,
+	})
+	if err != nil {
+		log.Print("Can't rehash password: ", err)
+	}
+}
+
+// createSession signs user in from the client of the request and returns
+// their access and refresh tokens. Failed logins of the user are forgotten
+// and a pending deletion of their account is called off.
+func (server *Server) createSession(ctx *gin.Context, user db.User) (loginUserResponse, error) {
+	err := server.store.DeleteLoginAttempt(ctx, db.DeleteLoginAttemptParams{
+		Kind:       loginKindUsername,
+		Identifier: user.Username,
+	})
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+	err = server.store.CancelAccountDeletion(ctx, user.Username)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+	// the session is identified by its refresh token
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.RefreshTokenDuration,
+		token.ForPurpose(token.PurposeRefresh),
+	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		server.config.AccessTokenDuration,
+		token.ForSession(refreshPayload.ID),
+	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:           refreshPayload.ID,
+		Username:     user.Username,
+		RefreshToken: refreshToken,
+		UserAgent:    ctx.Request.UserAgent(),
+		ClientIp:     ctx.ClientIP(),
+		IsBlocked:    false,
+		ExpiresAt:    refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		return loginUserResponse{}, err
+	}
 	res := UserResponse{
 		Name:      user.Name,
 		Username:  user.Username,
@@ -263,8 +439,12 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		CreatedAt: user.CreatedAt,
 	}
 	rsp := loginUserResponse{
-		AccessToken: accessToken,
-		User:        res,
+		SessionID:             session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		User:                  res,
 	}
-	ctx.JSON(http.StatusOK, rsp)
+	return rsp, nil
 }
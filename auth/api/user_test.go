@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func TestLoginRehashesPassword(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+
+	// accounts from before argon2id still have bcrypt hashes
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := store.users["alice"]
+	user.Password = string(bcryptHash)
+	store.users["alice"] = user
+
+	recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return strings.HasPrefix(store.users["alice"].Password, "$argon2id$")
+	}, time.Second, 10*time.Millisecond)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	login := func() loginUserResponse {
+		recorder := serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "secret"}, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var rsp loginUserResponse
+		decodeJSON(t, recorder, &rsp)
+		return rsp
+	}
+	other := login()
+	caller := login()
+
+	recorder := serveJSON(t, server, http.MethodPut, "/login", gin.H{"password": "new-secret"}, caller.AccessToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPut, "/login", gin.H{"current_password": "wrong", "password": "new-secret"}, caller.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	sent := len(notifier.messages)
+	recorder = serveJSON(t, server, http.MethodPut, "/login", gin.H{"current_password": "secret", "password": "new-secret"}, caller.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp UserResponse
+	decodeJSON(t, recorder, &rsp)
+	require.Equal(t, "alice", rsp.Username)
+	require.Equal(t, []string{"alice"}, store.apiKeysRevoked)
+
+	require.Len(t, notifier.messages, sent+1)
+	require.Equal(t, notify.TypePasswordChanged, notifier.messages[sent].Type)
+	require.Equal(t, "alice@example.com", notifier.messages[sent].Email)
+
+	// every other session is gone, the caller carries on with theirs
+	exchange := func(accessToken string) int {
+		return serveJSON(t, server, http.MethodPost, "/tokens/exchange", gin.H{"audience": "blog"}, accessToken).Code
+	}
+	require.Equal(t, http.StatusUnauthorized, exchange(other.AccessToken))
+	require.Equal(t, http.StatusOK, exchange(caller.AccessToken))
+	for id, session := range store.sessions {
+		require.Equal(t, id != caller.SessionID, session.IsBlocked)
+	}
+	recorder = serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": other.RefreshToken}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": caller.RefreshToken}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/login", gin.H{"username": "alice", "password": "new-secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+var (
+	errUsernameReserved  = errors.New("username was recently used by another account.")
+	errUsernameUnchanged = errors.New("username is already yours")
+)
+
+// usernameReserved reports whether username was given up recently by
+// someone other than owner, who may take their old name back
+func (server *Server) usernameReserved(ctx context.Context, username string, owner string) (bool, error) {
+	reservation, err := server.store.GetUsernameReservation(ctx, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return reservation.Username != owner, nil
+}
+
+type changeUsernameRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Password string `json:"password" binding:"required"`
+}
+
+// changeUsername renames the account of the caller. Other services learn the
+// new name from a user.renamed event, the old one stays reserved for a while
+// and resolves to the new one. Tokens carry the username, so the caller is
+// signed out everywhere and gets a fresh session under the new name.
+func (server *Server) changeUsername(ctx *gin.Context) {
+	var req changeUsernameRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if req.Username == authPayload.Username {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errUsernameUnchanged))
+		return
+	}
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !server.confirmPassword(ctx, user, req.Password) {
+		return
+	}
+	reserved, err := server.usernameReserved(ctx, req.Username, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if reserved {
+		ctx.JSON(http.StatusForbidden, errorResponse(errUsernameReserved))
+		return
+	}
+	oldUsername := user.Username
+	// the old name is revoked below by username. Reserving it until the last
+	// of its tokens expires and the next sync has pruned the revocation means
+	// the revocation is gone before the name can go to anyone else.
+	reservation := max(server.config.UsernameReservationPeriod, server.maxTokenLifetime()+2*revocationSyncInterval)
+	user, err = server.store.RenameUserTx(ctx, db.RenameUserTxParams{
+		Username:      oldUsername,
+		NewUsername:   req.Username,
+		ReservedUntil: time.Now().Add(reservation),
+		AfterRename: func(user db.User) error {
+			return server.notifier.Publish(ctx, notify.Event{
+				Type:        notify.EventUserRenamed,
+				Username:    user.Username,
+				OldUsername: oldUsername,
+				OccurredAt:  time.Now(),
+			})
+		},
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(errors.New("username already taken.")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the sessions moved to the new name with the user, their tokens still carry the old one
+	err = server.endUserSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	err = server.revocations.RevokeUser(ctx, oldUsername, server.maxTokenLifetime())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp, err := server.createSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func TestChangeUsername(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	notifier := server.notifier.(*testNotifier)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "bob", "bob@example.com").Code)
+	alice := loginWithUserAgent(t, server, "alice", firefoxLinux)
+
+	rename := func(accessToken string, username string, password string) *httptest.ResponseRecorder {
+		return serveJSON(t, server, http.MethodPut, "/username", gin.H{"username": username, "password": password}, accessToken)
+	}
+	getUser := func(username string) UserResponse {
+		recorder := serveJSON(t, server, http.MethodGet, "/?username="+username, nil, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var rsp UserResponse
+		decodeJSON(t, recorder, &rsp)
+		return rsp
+	}
+
+	require.Equal(t, http.StatusBadRequest, rename(alice.AccessToken, "not a name", "secret").Code)
+	require.Equal(t, http.StatusBadRequest, rename(alice.AccessToken, "alice", "secret").Code)
+	require.Equal(t, http.StatusUnauthorized, rename(alice.AccessToken, "carol", "wrong").Code)
+	require.Equal(t, http.StatusForbidden, rename(alice.AccessToken, "bob", "secret").Code)
+	require.Empty(t, notifier.events)
+
+	recorder := rename(alice.AccessToken, "carol", "secret")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var carol loginUserResponse
+	decodeJSON(t, recorder, &carol)
+	require.Equal(t, "carol", carol.User.Username)
+	require.Len(t, notifier.events, 1)
+	require.Equal(t, notify.EventUserRenamed, notifier.events[0].Type)
+	require.Equal(t, "carol", notifier.events[0].Username)
+	require.Equal(t, "alice", notifier.events[0].OldUsername)
+	require.NotContains(t, store.users, "alice")
+	require.Equal(t, "carol", store.sessions[alice.SessionID].Username)
+
+	// tokens issued to the old name stop working
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, alice.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/tokens/renew_access", gin.H{"refresh_token": alice.RefreshToken}, "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodGet, "/sessions", nil, carol.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var sessions []sessionResponse
+	decodeJSON(t, recorder, &sessions)
+	require.Len(t, sessions, 1)
+	require.Equal(t, carol.SessionID, sessions[0].ID)
+
+	// the old name resolves to the new one and nobody else can take it
+	require.Equal(t, "carol", getUser("alice").Username)
+	require.Equal(t, http.StatusForbidden, createTestUser(t, server, "alice", "mallory@example.com").Code)
+	bob := loginWithUserAgent(t, server, "bob", firefoxLinux)
+	require.Equal(t, http.StatusForbidden, rename(bob.AccessToken, "alice", "secret").Code)
+
+	// but its owner can take it back
+	recorder = rename(carol.AccessToken, "alice", "secret")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decodeJSON(t, recorder, &alice)
+	require.Equal(t, "alice", getUser("carol").Username)
+	require.Equal(t, "alice", getUser("alice").Username)
+	loginWithUserAgent(t, server, "alice", safariIPhone)
+
+	// once the reservation is over the old name no longer leads to alice
+	for i := range store.renames {
+		store.renames[i].ReservedUntil = time.Now()
+	}
+	recorder = serveJSON(t, server, http.MethodGet, "/?username=carol", nil, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// the export only has the impersonations of a name while alice had it
+	renamedAt, renamedBackAt := store.renames[0].ChangedAt, store.renames[1].ChangedAt
+	for _, impersonation := range []db.Impersonation{
+		{TargetUsername: "alice", Reason: "before alice", CreatedAt: store.users["alice"].CreatedAt.Add(-time.Minute)},
+		{TargetUsername: "alice", Reason: "as alice", CreatedAt: renamedAt.Add(-time.Nanosecond)},
+		{TargetUsername: "carol", Reason: "as carol", CreatedAt: renamedAt.Add(renamedBackAt.Sub(renamedAt) / 2)},
+		{TargetUsername: "carol", Reason: "after alice", CreatedAt: renamedBackAt.Add(time.Nanosecond)},
+	} {
+		impersonation.ID = uuid.New()
+		store.impersonations = append(store.impersonations, impersonation)
+	}
+
+	recorder = serveJSON(t, server, http.MethodGet, "/me/export", nil, alice.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var export accountExport
+	decodeJSON(t, recorder, &export)
+	require.Len(t, export.UsernameHistory, 2)
+	require.Equal(t, "carol", export.UsernameHistory[0].OldUsername)
+	require.Equal(t, "alice", export.UsernameHistory[1].OldUsername)
+	require.Equal(t, "alice", export.UsernameHistory[1].Username)
+	reasons := []string{}
+	for _, impersonation := range export.Impersonations {
+		reasons = append(reasons, impersonation.Reason)
+	}
+	require.ElementsMatch(t, []string{"as alice", "as carol"}, reasons)
+}
+
+func TestUsernameReservationOutlastsTokens(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+	server.config.UsernameReservationPeriod = time.Minute
+	require.Equal(t, http.StatusOK, createTestUser(t, server, "alice", "alice@example.com").Code)
+	alice := loginWithUserAgent(t, server, "alice", firefoxLinux)
+
+	recorder := serveJSON(t, server, http.MethodPut, "/username", gin.H{"username": "carol", "password": "secret"}, alice.AccessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	// the refresh token of alice lives longer than the configured reservation
+	require.Len(t, store.renames, 1)
+	require.False(t, store.renames[0].ReservedUntil.Before(alice.RefreshTokenExpiresAt))
+}
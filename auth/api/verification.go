@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// Purposes of the single use tokens kept in user_tokens
+const (
+	userTokenVerifyEmail   = "verify_email"
+	userTokenResetPassword = "reset_password"
+	userTokenMFAPending    = "mfa_pending"
+	userTokenMagicLink     = "magic_link"
+)
+
+var errInvalidVerificationLink = errors.New("verification link is invalid or has expired")
+
+// createUserToken stores the hash of a new single use token for username and
+// returns the token itself, which is only ever sent to email
+func (server *Server) createUserToken(ctx context.Context, username string, purpose string, email string, duration time.Duration) (string, error) {
+	rawToken, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = server.store.CreateUserToken(ctx, db.CreateUserTokenParams{
+		TokenHash: hashToken(rawToken),
+		Username:  username,
+		Purpose:   purpose,
+		Email:     sql.NullString{String: email, Valid: true},
+		ExpiresAt: time.Now().Add(duration),
+	})
+	return rawToken, err
+}
+
+// sendVerificationEmail mails a link confirming that email belongs to username
+func (server *Server) sendVerificationEmail(ctx context.Context, username string, email string) error {
+	rawToken, err := server.createUserToken(ctx, username, userTokenVerifyEmail, email, server.config.EmailVerificationDuration)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", server.config.PublicURL, url.QueryEscape(rawToken))
+	return server.notifier.Notify(ctx, notify.Message{
+		Type:    notify.TypeEmailVerification,
+		Email:   email,
+		Links:   []string{link},
+		Summary: fmt.Sprintf("Please confirm the email address of your account %s by opening the link below.", username),
+	})
+}
+
+type verifyEmailRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+type verifyEmailResponse struct {
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// verifyEmail marks the address a verification link was sent to as verified
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	userToken, err := server.store.UseUserToken(ctx, db.UseUserTokenParams{
+		TokenHash: hashToken(req.Token),
+		Purpose:   userTokenVerifyEmail,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidVerificationLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	user, err := server.store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{
+		Username: userToken.Username,
+		Email:    userToken.Email,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("email address has changed since the link was sent")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	rsp := verifyEmailResponse{
+		Username:      user.Username,
+		Email:         user.Email.String,
+		EmailVerified: user.EmailVerified,
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// resendVerificationEmail sends a new verification link, for when the first
+// one expired or was never delivered
+func (server *Server) resendVerificationEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !user.Email.Valid {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("no email address on the account")))
+		return
+	}
+	if user.EmailVerified {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("email address is already verified")))
+		return
+	}
+	err = server.sendVerificationEmail(ctx, user.Username, user.Email.String)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
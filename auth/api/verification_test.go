@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/notify"
+)
+
+func createTestUser(t *testing.T, server *Server, username string, email string) *httptest.ResponseRecorder {
+	body, err := json.Marshal(gin.H{
+		"username": username,
+		"email":    email,
+		"name":     "Test User",
+		"password": "secret",
+		"about":    "about",
+		"photo":    "photo",
+	})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// lastLinkToken returns the token of the link in the last message sent to email
+func lastLinkToken(t *testing.T, server *Server, email string) string {
+	notifier := server.notifier.(*testNotifier)
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for i := len(notifier.messages) - 1; i >= 0; i-- {
+		msg := notifier.messages[i]
+		if msg.Email != email {
+			continue
+		}
+		require.Len(t, msg.Links, 1)
+		link, err := url.Parse(msg.Links[0])
+		require.NoError(t, err)
+		return link.Query().Get("token")
+	}
+	require.FailNow(t, "no message sent to "+email)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	store := newMemoryStore()
+	server := NewTestServer(t, store)
+
+	recorder := createTestUser(t, server, "alice", "alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.False(t, store.users["alice"].EmailVerified)
+
+	notifier := server.notifier.(*testNotifier)
+	require.Len(t, notifier.messages, 1)
+	require.Equal(t, notify.TypeEmailVerification, notifier.messages[0].Type)
+
+	// the address can only be registered once
+	recorder = createTestUser(t, server, "bob", "alice@example.com")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	verify := func(t *testing.T, rawToken string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/verify-email?token="+url.QueryEscape(rawToken), nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	require.Equal(t, http.StatusBadRequest, verify(t, "invalid").Code)
+
+	rawToken := lastLinkToken(t, server, "alice@example.com")
+	recorder = verify(t, rawToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.True(t, store.users["alice"].EmailVerified)
+
+	// links are single use
+	require.Equal(t, http.StatusBadRequest, verify(t, rawToken).Code)
+}
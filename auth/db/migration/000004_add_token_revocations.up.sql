@@ -0,0 +1,17 @@
+CREATE TABLE "revoked_tokens"(
+	"id" uuid PRIMARY KEY,
+	"username" varchar NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"revoked_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "user_revocations"(
+	"username" varchar PRIMARY KEY,
+	"revoked_before" timestamptz NOT NULL,
+	"expires_at" timestamptz NOT NULL
+);
+
+CREATE INDEX ON "revoked_tokens" ("expires_at");
+
+ALTER TABLE "revoked_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "user_revocations" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
@@ -0,0 +1,15 @@
+CREATE TABLE "api_keys"(
+	"id" uuid PRIMARY KEY,
+	"username" varchar NOT NULL,
+	"name" varchar NOT NULL,
+	"key_hash" varchar UNIQUE NOT NULL,
+	"scopes" varchar[] NOT NULL,
+	"expires_at" timestamptz,
+	"last_used_at" timestamptz,
+	"revoked_at" timestamptz,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "api_keys" ("username", "name") WHERE "revoked_at" IS NULL;
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
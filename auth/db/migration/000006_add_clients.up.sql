@@ -0,0 +1,6 @@
+CREATE TABLE "clients"(
+	"client_id" varchar PRIMARY KEY,
+	"client_secret_hash" varchar NOT NULL,
+	"scopes" varchar[] NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
@@ -0,0 +1,14 @@
+-- no foreign keys to users, the audit trail outlives deleted accounts
+CREATE TABLE "impersonations"(
+	"id" uuid PRIMARY KEY,
+	"admin_username" varchar NOT NULL,
+	"target_username" varchar NOT NULL,
+	"reason" text NOT NULL,
+	"user_agent" varchar NOT NULL,
+	"client_ip" varchar NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "impersonations" ("admin_username");
+CREATE INDEX ON "impersonations" ("target_username");
@@ -0,0 +1,16 @@
+ALTER TABLE "users" ADD COLUMN "email" varchar UNIQUE;
+ALTER TABLE "users" ADD COLUMN "email_verified" boolean NOT NULL DEFAULT false;
+
+CREATE TABLE "user_tokens"(
+	"token_hash" varchar PRIMARY KEY,
+	"username" varchar NOT NULL,
+	"purpose" varchar NOT NULL,
+	"email" varchar NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"used_at" timestamptz,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "user_tokens" ("expires_at");
+
+ALTER TABLE "user_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
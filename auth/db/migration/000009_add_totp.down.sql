@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "recovery_codes";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "mfa_required";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_last_counter";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_enabled";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_secret";
@@ -0,0 +1,15 @@
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar;
+ALTER TABLE "users" ADD COLUMN "totp_enabled" boolean NOT NULL DEFAULT false;
+ALTER TABLE "users" ADD COLUMN "totp_last_counter" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "mfa_required" boolean NOT NULL DEFAULT false;
+
+CREATE TABLE "recovery_codes"(
+	"code_hash" varchar PRIMARY KEY,
+	"username" varchar NOT NULL,
+	"used_at" timestamptz,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "recovery_codes" ("username");
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
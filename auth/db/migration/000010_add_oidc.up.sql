@@ -0,0 +1,23 @@
+CREATE TABLE "oidc_logins"(
+	"state" varchar PRIMARY KEY,
+	"provider" varchar NOT NULL,
+	"nonce" varchar NOT NULL,
+	"code_verifier" varchar NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "oidc_logins" ("expires_at");
+
+CREATE TABLE "user_identities"(
+	"provider" varchar NOT NULL,
+	"subject" varchar NOT NULL,
+	"username" varchar NOT NULL,
+	"email" varchar,
+	"created_at" timestamptz NOT NULL DEFAULT (now()),
+	PRIMARY KEY ("provider", "subject")
+);
+
+CREATE INDEX ON "user_identities" ("username");
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
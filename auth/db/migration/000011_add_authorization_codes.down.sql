@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "consents";
+DROP TABLE IF EXISTS "authorization_codes";
+ALTER TABLE "clients" DROP COLUMN IF EXISTS "redirect_uris";
+ALTER TABLE "clients" DROP COLUMN IF EXISTS "name";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "id";
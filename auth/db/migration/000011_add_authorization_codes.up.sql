@@ -0,0 +1,34 @@
+-- the subject of ID tokens, an identifier that never changes or goes to
+-- another user, so relying parties can key their accounts by it
+ALTER TABLE "users" ADD COLUMN "id" uuid NOT NULL UNIQUE DEFAULT (gen_random_uuid());
+
+ALTER TABLE "clients" ADD COLUMN "name" varchar NOT NULL DEFAULT '';
+ALTER TABLE "clients" ADD COLUMN "redirect_uris" varchar[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE "authorization_codes"(
+	"code_hash" varchar PRIMARY KEY,
+	"client_id" varchar NOT NULL,
+	"username" varchar NOT NULL,
+	"redirect_uri" varchar NOT NULL,
+	"scopes" varchar[] NOT NULL,
+	"nonce" varchar NOT NULL,
+	"code_challenge" varchar NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "authorization_codes" ("expires_at");
+
+ALTER TABLE "authorization_codes" ADD FOREIGN KEY ("client_id") REFERENCES "clients" ("client_id") ON DELETE CASCADE;
+ALTER TABLE "authorization_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+
+CREATE TABLE "consents"(
+	"username" varchar NOT NULL,
+	"client_id" varchar NOT NULL,
+	"scopes" varchar[] NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now()),
+	PRIMARY KEY ("username", "client_id")
+);
+
+ALTER TABLE "consents" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "consents" ADD FOREIGN KEY ("client_id") REFERENCES "clients" ("client_id") ON DELETE CASCADE;
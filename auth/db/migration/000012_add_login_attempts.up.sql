@@ -0,0 +1,10 @@
+CREATE TABLE "login_attempts"(
+	"kind" varchar NOT NULL,
+	"identifier" varchar NOT NULL,
+	"failures" int NOT NULL,
+	"locked_until" timestamptz,
+	"last_failure_at" timestamptz NOT NULL DEFAULT (now()),
+	PRIMARY KEY ("kind", "identifier")
+);
+
+CREATE INDEX ON "login_attempts" ("last_failure_at");
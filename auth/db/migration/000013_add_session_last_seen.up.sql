@@ -0,0 +1,3 @@
+ALTER TABLE "sessions" ADD COLUMN "last_seen_at" timestamptz NOT NULL DEFAULT (now());
+
+CREATE INDEX ON "sessions" ("username");
@@ -0,0 +1,13 @@
+CREATE TABLE "login_events"(
+	"id" bigserial PRIMARY KEY,
+	"username" varchar NOT NULL,
+	"success" boolean NOT NULL,
+	"client_ip" varchar NOT NULL,
+	"user_agent" varchar NOT NULL,
+	"device" varchar NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "login_events" ("username", "created_at");
+
+ALTER TABLE "login_events" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
@@ -0,0 +1,10 @@
+-- accounts whose owners asked to delete them, they are removed for good after delete_after
+CREATE TABLE "account_deletions"(
+	"username" varchar PRIMARY KEY,
+	"delete_after" timestamptz NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "account_deletions" ("delete_after");
+
+ALTER TABLE "account_deletions" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS "username_changes";
+
+-- revocations of names that were changed or deleted go with the foreign key
+DELETE FROM "user_revocations" WHERE "username" NOT IN (SELECT "username" FROM "users");
+ALTER TABLE "user_revocations" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "sessions" DROP CONSTRAINT "sessions_username_fkey";
+ALTER TABLE "sessions" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "revoked_tokens" DROP CONSTRAINT "revoked_tokens_username_fkey";
+ALTER TABLE "revoked_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "api_keys" DROP CONSTRAINT "api_keys_username_fkey";
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "user_tokens" DROP CONSTRAINT "user_tokens_username_fkey";
+ALTER TABLE "user_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "recovery_codes" DROP CONSTRAINT "recovery_codes_username_fkey";
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "user_identities" DROP CONSTRAINT "user_identities_username_fkey";
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "authorization_codes" DROP CONSTRAINT "authorization_codes_username_fkey";
+ALTER TABLE "authorization_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "consents" DROP CONSTRAINT "consents_username_fkey";
+ALTER TABLE "consents" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "login_events" DROP CONSTRAINT "login_events_username_fkey";
+ALTER TABLE "login_events" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
+ALTER TABLE "account_deletions" DROP CONSTRAINT "account_deletions_username_fkey";
+ALTER TABLE "account_deletions" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE;
@@ -0,0 +1,38 @@
+-- usernames can change, rows that hang off a user follow the new name
+ALTER TABLE "sessions" DROP CONSTRAINT "sessions_username_fkey";
+ALTER TABLE "sessions" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "revoked_tokens" DROP CONSTRAINT "revoked_tokens_username_fkey";
+ALTER TABLE "revoked_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "api_keys" DROP CONSTRAINT "api_keys_username_fkey";
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "user_tokens" DROP CONSTRAINT "user_tokens_username_fkey";
+ALTER TABLE "user_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "recovery_codes" DROP CONSTRAINT "recovery_codes_username_fkey";
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "user_identities" DROP CONSTRAINT "user_identities_username_fkey";
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "authorization_codes" DROP CONSTRAINT "authorization_codes_username_fkey";
+ALTER TABLE "authorization_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "consents" DROP CONSTRAINT "consents_username_fkey";
+ALTER TABLE "consents" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "login_events" DROP CONSTRAINT "login_events_username_fkey";
+ALTER TABLE "login_events" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "account_deletions" DROP CONSTRAINT "account_deletions_username_fkey";
+ALTER TABLE "account_deletions" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- revocations are about the username tokens were issued to, which must stay revoked after a rename
+ALTER TABLE "user_revocations" DROP CONSTRAINT "user_revocations_username_fkey";
+
+-- old usernames of users, username is always the current name of the user
+CREATE TABLE "username_changes"(
+	"id" bigserial PRIMARY KEY,
+	"old_username" varchar NOT NULL,
+	"username" varchar NOT NULL,
+	"reserved_until" timestamptz NOT NULL,
+	"changed_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "username_changes" ("old_username", "changed_at");
+CREATE INDEX ON "username_changes" ("username");
+
+ALTER TABLE "username_changes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+DELETE FROM "user_tokens" WHERE "email" IS NULL;
+ALTER TABLE "user_tokens" ALTER COLUMN "email" SET NOT NULL;
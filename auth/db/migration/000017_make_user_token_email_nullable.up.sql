@@ -0,0 +1,2 @@
+-- only the tokens of links sent by email are tied to an address
+ALTER TABLE "user_tokens" ALTER COLUMN "email" DROP NOT NULL;
@@ -0,0 +1,25 @@
+-- name: ScheduleAccountDeletion :one
+INSERT INTO account_deletions (
+	username,
+	delete_after
+) VALUES (
+	$1, $2
+) ON CONFLICT (username) DO UPDATE SET delete_after=EXCLUDED.delete_after
+RETURNING *;
+
+-- name: CancelAccountDeletion :exec
+DELETE FROM account_deletions WHERE username=$1;
+
+-- name: ListDueAccountDeletions :many
+SELECT * FROM account_deletions
+WHERE delete_after <= now()
+ORDER BY delete_after
+LIMIT $1;
+
+-- name: DeleteDueUser :one
+DELETE FROM users
+WHERE username IN (
+	SELECT username FROM account_deletions
+	WHERE account_deletions.username=$1 AND delete_after <= now()
+)
+RETURNING *;
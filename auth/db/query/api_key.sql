@@ -0,0 +1,32 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys (
+	id,
+	username,
+	name,
+	key_hash,
+	scopes,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: GetApiKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash=$1 LIMIT 1;
+
+-- name: ListApiKeys :many
+SELECT * FROM api_keys
+WHERE username=$1
+ORDER BY created_at;
+
+-- name: RevokeApiKey :one
+UPDATE api_keys SET revoked_at=now()
+WHERE id=$1 AND username=$2 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeUserApiKeys :exec
+UPDATE api_keys SET revoked_at=now()
+WHERE username=$1 AND revoked_at IS NULL;
+
+-- name: UpdateApiKeyLastUsed :exec
+UPDATE api_keys SET last_used_at=now() WHERE id=$1;
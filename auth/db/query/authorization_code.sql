@@ -0,0 +1,22 @@
+-- name: CreateAuthorizationCode :one
+INSERT INTO authorization_codes (
+	code_hash,
+	client_id,
+	username,
+	redirect_uri,
+	scopes,
+	nonce,
+	code_challenge,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING *;
+
+-- name: UseAuthorizationCode :one
+DELETE FROM authorization_codes
+WHERE code_hash=$1 AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteExpiredAuthorizationCodes :exec
+DELETE FROM authorization_codes
+WHERE expires_at <= now();
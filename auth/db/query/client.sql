@@ -0,0 +1,14 @@
+-- name: CreateClient :one
+INSERT INTO clients (
+	client_id,
+	client_secret_hash,
+	scopes,
+	name,
+	redirect_uris
+) VALUES (
+	$1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetClient :one
+SELECT * FROM clients
+WHERE client_id=$1 LIMIT 1;
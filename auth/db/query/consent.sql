@@ -0,0 +1,14 @@
+-- name: GetConsent :one
+SELECT * FROM consents
+WHERE username=$1 AND client_id=$2 LIMIT 1;
+
+-- name: UpsertConsent :one
+INSERT INTO consents (
+	username,
+	client_id,
+	scopes
+) VALUES (
+	$1, $2, $3
+) ON CONFLICT (username, client_id) DO UPDATE
+SET scopes=EXCLUDED.scopes
+RETURNING *;
@@ -0,0 +1,19 @@
+-- name: CreateImpersonation :one
+INSERT INTO impersonations (
+	id,
+	admin_username,
+	target_username,
+	reason,
+	user_agent,
+	client_ip,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: ListImpersonations :many
+SELECT * FROM impersonations
+WHERE target_username=$1
+ORDER BY created_at DESC
+LIMIT $2
+OFFSET $3;
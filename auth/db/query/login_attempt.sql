@@ -0,0 +1,28 @@
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts
+WHERE kind=$1 AND identifier=$2 LIMIT 1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (
+	kind,
+	identifier,
+	failures
+) VALUES (
+	$1, $2, 1
+) ON CONFLICT (kind, identifier) DO UPDATE
+SET failures=CASE WHEN login_attempts.last_failure_at < sqlc.arg(reset_before) THEN 1 ELSE login_attempts.failures + 1 END,
+	last_failure_at=now()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_attempts
+SET locked_until=$3
+WHERE kind=$1 AND identifier=$2;
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts
+WHERE kind=$1 AND identifier=$2;
+
+-- name: DeleteExpiredLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= now());
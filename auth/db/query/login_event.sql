@@ -0,0 +1,25 @@
+-- name: CreateLoginEvent :one
+INSERT INTO login_events (
+	username,
+	success,
+	client_ip,
+	user_agent,
+	device
+) VALUES (
+	$1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetKnownLoginSources :one
+SELECT
+	COALESCE(bool_or(device=sqlc.arg(device)), false)::bool AS known_device,
+	COALESCE(bool_or(client_ip=sqlc.arg(client_ip)), false)::bool AS known_ip,
+	count(*) AS logins
+FROM login_events
+WHERE username=sqlc.arg(username) AND success;
+
+-- name: ListLoginEvents :many
+SELECT * FROM login_events
+WHERE username=$1
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+OFFSET $3;
@@ -0,0 +1,19 @@
+-- name: CreateOidcLogin :one
+INSERT INTO oidc_logins (
+	state,
+	provider,
+	nonce,
+	code_verifier,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: UseOidcLogin :one
+DELETE FROM oidc_logins
+WHERE state=$1 AND provider=$2 AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteExpiredOidcLogins :exec
+DELETE FROM oidc_logins
+WHERE expires_at <= now();
@@ -0,0 +1,16 @@
+-- name: CreateRecoveryCode :one
+INSERT INTO recovery_codes (
+	code_hash,
+	username
+) VALUES (
+	$1, $2
+) RETURNING *;
+
+-- name: UseRecoveryCode :one
+UPDATE recovery_codes SET used_at=now()
+WHERE code_hash=$1 AND username=$2 AND used_at IS NULL
+RETURNING *;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE username=$1;
@@ -0,0 +1,33 @@
+-- name: CreateRevokedToken :exec
+INSERT INTO revoked_tokens (
+	id,
+	username,
+	expires_at
+) VALUES (
+	$1, $2, $3
+) ON CONFLICT (id) DO NOTHING;
+
+-- name: ListRevokedTokens :many
+SELECT * FROM revoked_tokens
+WHERE expires_at > now();
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at <= now();
+
+-- name: UpsertUserRevocation :one
+INSERT INTO user_revocations (
+	username,
+	revoked_before,
+	expires_at
+) VALUES (
+	$1, $2, $3
+) ON CONFLICT (username) DO UPDATE
+SET revoked_before=EXCLUDED.revoked_before, expires_at=EXCLUDED.expires_at
+RETURNING *;
+
+-- name: ListUserRevocations :many
+SELECT * FROM user_revocations
+WHERE expires_at > now();
+
+-- name: DeleteExpiredUserRevocations :exec
+DELETE FROM user_revocations WHERE expires_at <= now();
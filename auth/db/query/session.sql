@@ -0,0 +1,35 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+	id,
+	username,
+	refresh_token,
+	user_agent,
+	client_ip,
+	is_blocked,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id=$1 LIMIT 1;
+
+-- name: BlockSession :exec
+UPDATE sessions SET is_blocked=true WHERE id=$1;
+
+-- name: BlockUserSessions :exec
+UPDATE sessions SET is_blocked=true WHERE username=$1;
+
+-- name: ListUserSessions :many
+SELECT * FROM sessions
+WHERE username=$1 AND is_blocked=false AND expires_at > now()
+ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_seen_at=now() WHERE id=$1;
+
+-- name: ListAllUserSessions :many
+SELECT * FROM sessions
+WHERE username=$1
+ORDER BY created_at DESC;
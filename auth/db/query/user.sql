@@ -5,20 +5,64 @@ INSERT INTO users (
 	password,
 	about,
 	photo,
-	role
+	role,
+	email
 ) VALUES (
-	$1, $2, $3, $4, $5, $6
+	$1, $2, $3, $4, $5, $6, $7
 ) RETURNING *;
 
 -- name: GetUser :one
 SELECT * FROM users
 WHERE username=$1 LIMIT 1;
 
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email=$1 LIMIT 1;
+
 -- name: UpdateUser :one
 UPDATE users SET name=$1, about=$2, photo=$3 WHERE username=$4 RETURNING *;
 
 -- name: UpdatePassword :one
 UPDATE users SET password=$1 WHERE username=$2 RETURNING *;
 
+-- name: RehashPassword :exec
+UPDATE users SET password=sqlc.arg(new_password)
+WHERE username=sqlc.arg(username) AND password=sqlc.arg(old_password);
+
+-- name: RenameUser :one
+UPDATE users SET username=sqlc.arg(new_username)
+WHERE username=sqlc.arg(username)
+RETURNING *;
+
 -- name: UpdateRole :one
 UPDATE users SET role=$1 WHERE username=$2 RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users SET email_verified=true
+WHERE username=$1 AND email=$2
+RETURNING *;
+
+-- name: SetUserTotpSecret :one
+UPDATE users SET totp_secret=$2, totp_enabled=false, totp_last_counter=0
+WHERE username=$1 AND totp_enabled=false
+RETURNING *;
+
+-- name: EnableUserTotp :one
+UPDATE users SET totp_enabled=true
+WHERE username=$1 AND totp_secret IS NOT NULL
+RETURNING *;
+
+-- name: DisableUserTotp :one
+UPDATE users SET totp_secret=NULL, totp_enabled=false, totp_last_counter=0
+WHERE username=$1
+RETURNING *;
+
+-- name: UpdateUserTotpCounter :one
+UPDATE users SET totp_last_counter=$2
+WHERE username=$1 AND totp_last_counter < $2
+RETURNING *;
+
+-- name: UpdateUserMfaRequired :one
+UPDATE users SET mfa_required=$2
+WHERE username=$1
+RETURNING *;
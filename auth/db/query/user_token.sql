@@ -0,0 +1,20 @@
+-- name: CreateUserToken :one
+INSERT INTO user_tokens (
+	token_hash,
+	username,
+	purpose,
+	email,
+	expires_at
+) VALUES (
+	$1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetUserToken :one
+SELECT * FROM user_tokens
+WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()
+LIMIT 1;
+
+-- name: UseUserToken :one
+UPDATE user_tokens SET used_at=now()
+WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()
+RETURNING *;
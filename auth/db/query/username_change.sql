@@ -0,0 +1,19 @@
+-- name: CreateUsernameChange :one
+INSERT INTO username_changes (
+	old_username,
+	username,
+	reserved_until
+) VALUES (
+	$1, $2, $3
+) RETURNING *;
+
+-- name: GetUsernameReservation :one
+SELECT * FROM username_changes
+WHERE old_username=$1 AND reserved_until > now()
+ORDER BY changed_at DESC
+LIMIT 1;
+
+-- name: ListUsernameChanges :many
+SELECT * FROM username_changes
+WHERE username=$1
+ORDER BY changed_at DESC;
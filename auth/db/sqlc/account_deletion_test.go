@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	store := NewStore(testDB)
+	user := CreateRandomUser(t)
+	schedule := func(deleteAfter time.Time) {
+		deletion, err := testQueries.ScheduleAccountDeletion(context.Background(), ScheduleAccountDeletionParams{
+			Username:    user.Username,
+			DeleteAfter: deleteAfter,
+		})
+		require.NoError(t, err)
+		require.Equal(t, user.Username, deletion.Username)
+		require.WithinDuration(t, deleteAfter, deletion.DeleteAfter, time.Second)
+	}
+	isDue := func() bool {
+		due, err := testQueries.ListDueAccountDeletions(context.Background(), 1000)
+		require.NoError(t, err)
+		for _, deletion := range due {
+			if deletion.Username == user.Username {
+				return true
+			}
+		}
+		return false
+	}
+	deleteAccount := func(afterDelete func(User) error) (User, error) {
+		return store.DeleteAccountTx(context.Background(), DeleteAccountTxParams{
+			Username:    user.Username,
+			AfterDelete: afterDelete,
+		})
+	}
+	noop := func(User) error { return nil }
+
+	// accounts in their grace period are kept
+	schedule(time.Now().Add(time.Hour))
+	require.False(t, isDue())
+	_, err := deleteAccount(noop)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// rescheduling moves the deadline
+	schedule(time.Now().Add(-time.Minute))
+	require.True(t, isDue())
+
+	// the account survives a failing AfterDelete
+	_, err = deleteAccount(func(User) error { return errors.New("broker is down") })
+	require.Error(t, err)
+	_, err = testQueries.GetUser(context.Background(), user.Username)
+	require.NoError(t, err)
+
+	// a cancelled deletion is not due anymore
+	require.NoError(t, testQueries.CancelAccountDeletion(context.Background(), user.Username))
+	require.False(t, isDue())
+	_, err = deleteAccount(noop)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	schedule(time.Now().Add(-time.Minute))
+	deleted, err := deleteAccount(noop)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, deleted.Username)
+	_, err = testQueries.GetUser(context.Background(), user.Username)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.False(t, isDue())
+}
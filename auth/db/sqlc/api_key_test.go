@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomApiKey(t *testing.T) ApiKey {
+	user := CreateRandomUser(t)
+	args := CreateApiKeyParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		Name:      utils.RandomString(8),
+		KeyHash:   utils.RandomString(64),
+		Scopes:    []string{"blog:write"},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	}
+	apiKey, err := testQueries.CreateApiKey(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.ID, apiKey.ID)
+	require.Equal(t, args.Username, apiKey.Username)
+	require.Equal(t, args.Name, apiKey.Name)
+	require.Equal(t, args.KeyHash, apiKey.KeyHash)
+	require.Equal(t, args.Scopes, apiKey.Scopes)
+	require.WithinDuration(t, args.ExpiresAt.Time, apiKey.ExpiresAt.Time, time.Second)
+	require.False(t, apiKey.LastUsedAt.Valid)
+	require.False(t, apiKey.RevokedAt.Valid)
+
+	return apiKey
+}
+
+func TestCreateApiKey(t *testing.T) {
+	CreateRandomApiKey(t)
+}
+
+func TestGetApiKeyByHash(t *testing.T) {
+	apiKey1 := CreateRandomApiKey(t)
+	apiKey2, err := testQueries.GetApiKeyByHash(context.Background(), apiKey1.KeyHash)
+	require.NoError(t, err)
+	require.Equal(t, apiKey1.ID, apiKey2.ID)
+	require.Equal(t, apiKey1.Scopes, apiKey2.Scopes)
+}
+
+func TestUpdateApiKeyLastUsed(t *testing.T) {
+	apiKey1 := CreateRandomApiKey(t)
+	err := testQueries.UpdateApiKeyLastUsed(context.Background(), apiKey1.ID)
+	require.NoError(t, err)
+
+	apiKey2, err := testQueries.GetApiKeyByHash(context.Background(), apiKey1.KeyHash)
+	require.NoError(t, err)
+	require.True(t, apiKey2.LastUsedAt.Valid)
+	require.WithinDuration(t, time.Now(), apiKey2.LastUsedAt.Time, time.Minute)
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	apiKey1 := CreateRandomApiKey(t)
+	apiKey2, err := testQueries.RevokeApiKey(context.Background(), RevokeApiKeyParams{
+		ID:       apiKey1.ID,
+		Username: apiKey1.Username,
+	})
+	require.NoError(t, err)
+	require.True(t, apiKey2.RevokedAt.Valid)
+
+	// a revoked key cannot be revoked again
+	_, err = testQueries.RevokeApiKey(context.Background(), RevokeApiKeyParams{
+		ID:       apiKey1.ID,
+		Username: apiKey1.Username,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestListAndRevokeUserApiKeys(t *testing.T) {
+	apiKey := CreateRandomApiKey(t)
+	err := testQueries.RevokeUserApiKeys(context.Background(), apiKey.Username)
+	require.NoError(t, err)
+
+	apiKeys, err := testQueries.ListApiKeys(context.Background(), apiKey.Username)
+	require.NoError(t, err)
+	require.Len(t, apiKeys, 1)
+	require.Equal(t, apiKey.ID, apiKeys[0].ID)
+	require.True(t, apiKeys[0].RevokedAt.Valid)
+}
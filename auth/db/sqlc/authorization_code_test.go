@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomAuthorizationCode(t *testing.T, expiresAt time.Time) AuthorizationCode {
+	client := CreateRandomClient(t)
+	user := CreateRandomUser(t)
+	args := CreateAuthorizationCodeParams{
+		CodeHash:      utils.RandomString(64),
+		ClientID:      client.ClientID,
+		Username:      user.Username,
+		RedirectUri:   client.RedirectUris[0],
+		Scopes:        []string{"openid", "email"},
+		Nonce:         utils.RandomString(32),
+		CodeChallenge: utils.RandomString(43),
+		ExpiresAt:     expiresAt,
+	}
+	code, err := testQueries.CreateAuthorizationCode(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.CodeHash, code.CodeHash)
+	require.Equal(t, args.ClientID, code.ClientID)
+	require.Equal(t, args.Username, code.Username)
+	require.Equal(t, args.RedirectUri, code.RedirectUri)
+	require.Equal(t, args.Scopes, code.Scopes)
+	require.Equal(t, args.Nonce, code.Nonce)
+	require.Equal(t, args.CodeChallenge, code.CodeChallenge)
+	require.WithinDuration(t, args.ExpiresAt, code.ExpiresAt, time.Second)
+
+	return code
+}
+
+func TestCreateAuthorizationCode(t *testing.T) {
+	CreateRandomAuthorizationCode(t, time.Now().Add(time.Minute))
+}
+
+func TestUseAuthorizationCode(t *testing.T) {
+	code1 := CreateRandomAuthorizationCode(t, time.Now().Add(time.Minute))
+	code2, err := testQueries.UseAuthorizationCode(context.Background(), code1.CodeHash)
+	require.NoError(t, err)
+	require.Equal(t, code1.Username, code2.Username)
+
+	// codes are single use
+	_, err = testQueries.UseAuthorizationCode(context.Background(), code1.CodeHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseExpiredAuthorizationCode(t *testing.T) {
+	code := CreateRandomAuthorizationCode(t, time.Now().Add(-time.Minute))
+	_, err := testQueries.UseAuthorizationCode(context.Background(), code.CodeHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = testQueries.DeleteExpiredAuthorizationCodes(context.Background())
+	require.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomClient(t *testing.T) Client {
+	args := CreateClientParams{
+		ClientID:         utils.RandomString(10),
+		ClientSecretHash: utils.RandomString(60),
+		Scopes:           []string{"blog:write"},
+		Name:             utils.RandomString(8),
+		RedirectUris:     []string{"https://" + utils.RandomString(8) + ".example.com/callback"},
+	}
+	client, err := testQueries.CreateClient(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.ClientID, client.ClientID)
+	require.Equal(t, args.ClientSecretHash, client.ClientSecretHash)
+	require.Equal(t, args.Scopes, client.Scopes)
+	require.Equal(t, args.Name, client.Name)
+	require.Equal(t, args.RedirectUris, client.RedirectUris)
+	require.NotZero(t, client.CreatedAt)
+
+	return client
+}
+
+func TestCreateClient(t *testing.T) {
+	CreateRandomClient(t)
+}
+
+func TestGetClient(t *testing.T) {
+	client1 := CreateRandomClient(t)
+	client2, err := testQueries.GetClient(context.Background(), client1.ClientID)
+	require.NoError(t, err)
+	require.Equal(t, client1.ClientID, client2.ClientID)
+	require.Equal(t, client1.Scopes, client2.Scopes)
+	require.Equal(t, client1.RedirectUris, client2.RedirectUris)
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertConsent(t *testing.T) {
+	client := CreateRandomClient(t)
+	user := CreateRandomUser(t)
+
+	_, err := testQueries.GetConsent(context.Background(), GetConsentParams{
+		Username: user.Username,
+		ClientID: client.ClientID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	consent1, err := testQueries.UpsertConsent(context.Background(), UpsertConsentParams{
+		Username: user.Username,
+		ClientID: client.ClientID,
+		Scopes:   []string{"openid"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"openid"}, consent1.Scopes)
+
+	// consenting again replaces the scopes
+	consent2, err := testQueries.UpsertConsent(context.Background(), UpsertConsentParams{
+		Username: user.Username,
+		ClientID: client.ClientID,
+		Scopes:   []string{"openid", "email"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"openid", "email"}, consent2.Scopes)
+	require.Equal(t, consent1.CreatedAt, consent2.CreatedAt)
+
+	consent3, err := testQueries.GetConsent(context.Background(), GetConsentParams{
+		Username: user.Username,
+		ClientID: client.ClientID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, consent2.Scopes, consent3.Scopes)
+}
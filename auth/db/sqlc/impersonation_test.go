@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomImpersonation(t *testing.T, target User) Impersonation {
+	admin := CreateRandomUser(t)
+	args := CreateImpersonationParams{
+		ID:             uuid.New(),
+		AdminUsername:  admin.Username,
+		TargetUsername: target.Username,
+		Reason:         utils.RandomString(20),
+		UserAgent:      utils.RandomString(10),
+		ClientIp:       "127.0.0.1",
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}
+	impersonation, err := testQueries.CreateImpersonation(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.ID, impersonation.ID)
+	require.Equal(t, args.AdminUsername, impersonation.AdminUsername)
+	require.Equal(t, args.TargetUsername, impersonation.TargetUsername)
+	require.Equal(t, args.Reason, impersonation.Reason)
+	require.WithinDuration(t, args.ExpiresAt, impersonation.ExpiresAt, time.Second)
+	require.NotZero(t, impersonation.CreatedAt)
+
+	return impersonation
+}
+
+func TestCreateImpersonation(t *testing.T) {
+	CreateRandomImpersonation(t, CreateRandomUser(t))
+}
+
+func TestListImpersonations(t *testing.T) {
+	target := CreateRandomUser(t)
+	for i := 0; i < 3; i++ {
+		CreateRandomImpersonation(t, target)
+	}
+
+	impersonations, err := testQueries.ListImpersonations(context.Background(), ListImpersonationsParams{
+		TargetUsername: target.Username,
+		Limit:          2,
+		Offset:         0,
+	})
+	require.NoError(t, err)
+	require.Len(t, impersonations, 2)
+	for _, impersonation := range impersonations {
+		require.Equal(t, target.Username, impersonation.TargetUsername)
+	}
+}
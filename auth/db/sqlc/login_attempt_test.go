@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestRecordLoginFailure(t *testing.T) {
+	key := GetLoginAttemptParams{Kind: "username", Identifier: utils.RandomString(8)}
+	record := func(resetBefore time.Time) LoginAttempt {
+		attempt, err := testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+			Kind:        key.Kind,
+			Identifier:  key.Identifier,
+			ResetBefore: resetBefore,
+		})
+		require.NoError(t, err)
+		return attempt
+	}
+
+	require.Equal(t, int32(1), record(time.Now().Add(-time.Hour)).Failures)
+	require.Equal(t, int32(2), record(time.Now().Add(-time.Hour)).Failures)
+	// failures older than the window are forgotten
+	require.Equal(t, int32(1), record(time.Now().Add(time.Hour)).Failures)
+
+	lockedUntil := time.Now().Add(time.Minute)
+	err := testQueries.LockLogin(context.Background(), LockLoginParams{
+		Kind:        key.Kind,
+		Identifier:  key.Identifier,
+		LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true},
+	})
+	require.NoError(t, err)
+	attempt, err := testQueries.GetLoginAttempt(context.Background(), key)
+	require.NoError(t, err)
+	require.WithinDuration(t, lockedUntil, attempt.LockedUntil.Time, time.Second)
+
+	// locked attempts are kept until the lock is over
+	err = testQueries.DeleteExpiredLoginAttempts(context.Background(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = testQueries.GetLoginAttempt(context.Background(), key)
+	require.NoError(t, err)
+
+	err = testQueries.DeleteLoginAttempt(context.Background(), DeleteLoginAttemptParams(key))
+	require.NoError(t, err)
+	_, err = testQueries.GetLoginAttempt(context.Background(), key)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
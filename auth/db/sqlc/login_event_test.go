@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginEvents(t *testing.T) {
+	user := CreateRandomUser(t)
+	create := func(success bool, clientIP string, device string) LoginEvent {
+		args := CreateLoginEventParams{
+			Username:  user.Username,
+			Success:   success,
+			ClientIp:  clientIP,
+			UserAgent: device + " user agent",
+			Device:    device,
+		}
+		event, err := testQueries.CreateLoginEvent(context.Background(), args)
+		require.NoError(t, err)
+		require.Equal(t, args.Username, event.Username)
+		require.Equal(t, args.Success, event.Success)
+		require.Equal(t, args.ClientIp, event.ClientIp)
+		require.Equal(t, args.UserAgent, event.UserAgent)
+		require.Equal(t, args.Device, event.Device)
+		require.NotZero(t, event.CreatedAt)
+		return event
+	}
+	known := func(clientIP string, device string) GetKnownLoginSourcesRow {
+		row, err := testQueries.GetKnownLoginSources(context.Background(), GetKnownLoginSourcesParams{
+			Device:   device,
+			ClientIp: clientIP,
+			Username: user.Username,
+		})
+		require.NoError(t, err)
+		return row
+	}
+
+	require.Equal(t, GetKnownLoginSourcesRow{}, known("192.0.2.1", "Firefox on Linux"))
+	first := create(true, "192.0.2.1", "Firefox on Linux")
+	// failed logins do not make a device known
+	last := create(false, "192.0.2.2", "Safari on iOS")
+	require.Equal(t, GetKnownLoginSourcesRow{KnownDevice: true, KnownIp: true, Logins: 1}, known("192.0.2.1", "Firefox on Linux"))
+	require.Equal(t, GetKnownLoginSourcesRow{KnownDevice: false, KnownIp: false, Logins: 1}, known("192.0.2.2", "Safari on iOS"))
+
+	events, err := testQueries.ListLoginEvents(context.Background(), ListLoginEventsParams{
+		Username: user.Username,
+		Limit:    5,
+		Offset:   0,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, last.ID, events[0].ID)
+	require.Equal(t, first.ID, events[1].ID)
+}
@@ -5,19 +5,171 @@
 package db
 
 import (
+	"database/sql"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+type AccountDeletion struct {
+	Username    string    `json:"username"`
+	DeleteAfter time.Time `json:"delete_after"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	Username   string       `json:"username"`
+	Name       string       `json:"name"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type AuthorizationCode struct {
+	CodeHash      string    `json:"code_hash"`
+	ClientID      string    `json:"client_id"`
+	Username      string    `json:"username"`
+	RedirectUri   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type Client struct {
+	ClientID         string    `json:"client_id"`
+	ClientSecretHash string    `json:"client_secret_hash"`
+	Scopes           []string  `json:"scopes"`
+	CreatedAt        time.Time `json:"created_at"`
+	Name             string    `json:"name"`
+	RedirectUris     []string  `json:"redirect_uris"`
+}
+
+type Consent struct {
+	Username  string    `json:"username"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Impersonation struct {
+	ID             uuid.UUID `json:"id"`
+	AdminUsername  string    `json:"admin_username"`
+	TargetUsername string    `json:"target_username"`
+	Reason         string    `json:"reason"`
+	UserAgent      string    `json:"user_agent"`
+	ClientIp       string    `json:"client_ip"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Kind          string       `json:"kind"`
+	Identifier    string       `json:"identifier"`
+	Failures      int32        `json:"failures"`
+	LockedUntil   sql.NullTime `json:"locked_until"`
+	LastFailureAt time.Time    `json:"last_failure_at"`
+}
+
+type LoginEvent struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Success   bool      `json:"success"`
+	ClientIp  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Device    string    `json:"device"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OidcLogin struct {
+	State        string    `json:"state"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type RecoveryCode struct {
+	CodeHash  string       `json:"code_hash"`
+	Username  string       `json:"username"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RevokedToken struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
 type Role struct {
 	Role string `json:"role"`
 }
 
+type Session struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	RefreshToken string    `json:"refresh_token"`
+	UserAgent    string    `json:"user_agent"`
+	ClientIp     string    `json:"client_ip"`
+	IsBlocked    bool      `json:"is_blocked"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+}
+
 type User struct {
-	Username  string    `json:"username"`
-	Name      string    `json:"name"`
-	Password  string    `json:"password"`
-	About     string    `json:"about"`
-	Photo     string    `json:"photo"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	Username        string         `json:"username"`
+	Name            string         `json:"name"`
+	Password        string         `json:"password"`
+	About           string         `json:"about"`
+	Photo           string         `json:"photo"`
+	Role            string         `json:"role"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Email           sql.NullString `json:"email"`
+	EmailVerified   bool           `json:"email_verified"`
+	TotpSecret      sql.NullString `json:"totp_secret"`
+	TotpEnabled     bool           `json:"totp_enabled"`
+	TotpLastCounter int64          `json:"totp_last_counter"`
+	MfaRequired     bool           `json:"mfa_required"`
+	ID              uuid.UUID      `json:"id"`
+}
+
+type UserIdentity struct {
+	Provider  string         `json:"provider"`
+	Subject   string         `json:"subject"`
+	Username  string         `json:"username"`
+	Email     sql.NullString `json:"email"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type UserRevocation struct {
+	Username      string    `json:"username"`
+	RevokedBefore time.Time `json:"revoked_before"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type UserToken struct {
+	TokenHash string         `json:"token_hash"`
+	Username  string         `json:"username"`
+	Purpose   string         `json:"purpose"`
+	Email     sql.NullString `json:"email"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	UsedAt    sql.NullTime   `json:"used_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type UsernameChange struct {
+	ID            int64     `json:"id"`
+	OldUsername   string    `json:"old_username"`
+	Username      string    `json:"username"`
+	ReservedUntil time.Time `json:"reserved_until"`
+	ChangedAt     time.Time `json:"changed_at"`
 }
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomOidcLogin(t *testing.T, expiresAt time.Time) OidcLogin {
+	args := CreateOidcLoginParams{
+		State:        utils.RandomString(32),
+		Provider:     utils.RandomString(6),
+		Nonce:        utils.RandomString(32),
+		CodeVerifier: utils.RandomString(43),
+		ExpiresAt:    expiresAt,
+	}
+	login, err := testQueries.CreateOidcLogin(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.State, login.State)
+	require.Equal(t, args.Provider, login.Provider)
+	require.Equal(t, args.Nonce, login.Nonce)
+	require.Equal(t, args.CodeVerifier, login.CodeVerifier)
+	require.WithinDuration(t, args.ExpiresAt, login.ExpiresAt, time.Second)
+
+	return login
+}
+
+func TestCreateOidcLogin(t *testing.T) {
+	CreateRandomOidcLogin(t, time.Now().Add(time.Minute))
+}
+
+func TestUseOidcLogin(t *testing.T) {
+	login := CreateRandomOidcLogin(t, time.Now().Add(time.Minute))
+
+	// the state only works with the provider it was created for
+	_, err := testQueries.UseOidcLogin(context.Background(), UseOidcLoginParams{
+		State:    login.State,
+		Provider: utils.RandomString(6),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	args := UseOidcLoginParams{
+		State:    login.State,
+		Provider: login.Provider,
+	}
+	used, err := testQueries.UseOidcLogin(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, login.CodeVerifier, used.CodeVerifier)
+
+	// and only once
+	_, err = testQueries.UseOidcLogin(context.Background(), args)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteExpiredOidcLogins(t *testing.T) {
+	login := CreateRandomOidcLogin(t, time.Now().Add(-time.Minute))
+	_, err := testQueries.UseOidcLogin(context.Background(), UseOidcLoginParams{
+		State:    login.State,
+		Provider: login.Provider,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = testQueries.DeleteExpiredOidcLogins(context.Background())
+	require.NoError(t, err)
+}
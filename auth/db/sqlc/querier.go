@@ -6,16 +6,83 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
+	BlockSession(ctx context.Context, id uuid.UUID) error
+	BlockUserSessions(ctx context.Context, username string) error
+	CancelAccountDeletion(ctx context.Context, username string) error
+	CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error)
+	CreateAuthorizationCode(ctx context.Context, arg CreateAuthorizationCodeParams) (AuthorizationCode, error)
+	CreateClient(ctx context.Context, arg CreateClientParams) (Client, error)
+	CreateImpersonation(ctx context.Context, arg CreateImpersonationParams) (Impersonation, error)
+	CreateLoginEvent(ctx context.Context, arg CreateLoginEventParams) (LoginEvent, error)
+	CreateOidcLogin(ctx context.Context, arg CreateOidcLoginParams) (OidcLogin, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error)
+	CreateRevokedToken(ctx context.Context, arg CreateRevokedTokenParams) error
 	CreateRole(ctx context.Context, role string) (string, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	CreateUserToken(ctx context.Context, arg CreateUserTokenParams) (UserToken, error)
+	CreateUsernameChange(ctx context.Context, arg CreateUsernameChangeParams) (UsernameChange, error)
+	DeleteDueUser(ctx context.Context, username string) (User, error)
+	DeleteExpiredAuthorizationCodes(ctx context.Context) error
+	DeleteExpiredLoginAttempts(ctx context.Context, lastFailureAt time.Time) error
+	DeleteExpiredOidcLogins(ctx context.Context) error
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	DeleteExpiredUserRevocations(ctx context.Context) error
+	DeleteLoginAttempt(ctx context.Context, arg DeleteLoginAttemptParams) error
+	DeleteRecoveryCodes(ctx context.Context, username string) error
 	DeleteRole(ctx context.Context, role string) error
+	DisableUserTotp(ctx context.Context, username string) (User, error)
+	EnableUserTotp(ctx context.Context, username string) (User, error)
+	GetApiKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetClient(ctx context.Context, clientID string) (Client, error)
+	GetConsent(ctx context.Context, arg GetConsentParams) (Consent, error)
+	GetKnownLoginSources(ctx context.Context, arg GetKnownLoginSourcesParams) (GetKnownLoginSourcesRow, error)
+	GetLoginAttempt(ctx context.Context, arg GetLoginAttemptParams) (LoginAttempt, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email sql.NullString) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	GetUserToken(ctx context.Context, arg GetUserTokenParams) (UserToken, error)
+	GetUsernameReservation(ctx context.Context, oldUsername string) (UsernameChange, error)
+	ListAllUserSessions(ctx context.Context, username string) ([]Session, error)
+	ListApiKeys(ctx context.Context, username string) ([]ApiKey, error)
+	ListDueAccountDeletions(ctx context.Context, limit int32) ([]AccountDeletion, error)
+	ListImpersonations(ctx context.Context, arg ListImpersonationsParams) ([]Impersonation, error)
+	ListLoginEvents(ctx context.Context, arg ListLoginEventsParams) ([]LoginEvent, error)
+	ListRevokedTokens(ctx context.Context) ([]RevokedToken, error)
+	ListUserRevocations(ctx context.Context) ([]UserRevocation, error)
+	ListUserSessions(ctx context.Context, username string) ([]Session, error)
+	ListUsernameChanges(ctx context.Context, username string) ([]UsernameChange, error)
+	LockLogin(ctx context.Context, arg LockLoginParams) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginAttempt, error)
+	RehashPassword(ctx context.Context, arg RehashPasswordParams) error
+	RenameUser(ctx context.Context, arg RenameUserParams) (User, error)
+	RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (ApiKey, error)
+	RevokeUserApiKeys(ctx context.Context, username string) error
+	ScheduleAccountDeletion(ctx context.Context, arg ScheduleAccountDeletionParams) (AccountDeletion, error)
+	SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (User, error)
+	TouchSession(ctx context.Context, id uuid.UUID) error
+	UpdateApiKeyLastUsed(ctx context.Context, id uuid.UUID) error
 	UpdatePassword(ctx context.Context, arg UpdatePasswordParams) (User, error)
 	UpdateRole(ctx context.Context, arg UpdateRoleParams) (User, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserMfaRequired(ctx context.Context, arg UpdateUserMfaRequiredParams) (User, error)
+	UpdateUserTotpCounter(ctx context.Context, arg UpdateUserTotpCounterParams) (User, error)
+	UpsertConsent(ctx context.Context, arg UpsertConsentParams) (Consent, error)
+	UpsertUserRevocation(ctx context.Context, arg UpsertUserRevocationParams) (UserRevocation, error)
+	UseAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	UseOidcLogin(ctx context.Context, arg UseOidcLoginParams) (OidcLogin, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error)
+	UseUserToken(ctx context.Context, arg UseUserTokenParams) (UserToken, error)
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
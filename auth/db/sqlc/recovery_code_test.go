@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomRecoveryCode(t *testing.T, username string) RecoveryCode {
+	args := CreateRecoveryCodeParams{
+		CodeHash: utils.RandomString(64),
+		Username: username,
+	}
+	recoveryCode, err := testQueries.CreateRecoveryCode(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.CodeHash, recoveryCode.CodeHash)
+	require.Equal(t, args.Username, recoveryCode.Username)
+	require.False(t, recoveryCode.UsedAt.Valid)
+	require.NotZero(t, recoveryCode.CreatedAt)
+
+	return recoveryCode
+}
+
+func TestCreateRecoveryCode(t *testing.T) {
+	user := CreateRandomUser(t)
+	CreateRandomRecoveryCode(t, user.Username)
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	user2 := CreateRandomUser(t)
+	recoveryCode := CreateRandomRecoveryCode(t, user1.Username)
+
+	// codes only work for their owner
+	_, err := testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{
+		CodeHash: recoveryCode.CodeHash,
+		Username: user2.Username,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	args := UseRecoveryCodeParams{
+		CodeHash: recoveryCode.CodeHash,
+		Username: user1.Username,
+	}
+	used, err := testQueries.UseRecoveryCode(context.Background(), args)
+	require.NoError(t, err)
+	require.True(t, used.UsedAt.Valid)
+
+	// and only once
+	_, err = testQueries.UseRecoveryCode(context.Background(), args)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteRecoveryCodes(t *testing.T) {
+	user := CreateRandomUser(t)
+	recoveryCode := CreateRandomRecoveryCode(t, user.Username)
+
+	err := testQueries.DeleteRecoveryCodes(context.Background(), user.Username)
+	require.NoError(t, err)
+
+	_, err = testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{
+		CodeHash: recoveryCode.CodeHash,
+		Username: user.Username,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
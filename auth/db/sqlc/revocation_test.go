@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRevokedToken(t *testing.T) {
+	user := CreateRandomUser(t)
+	args := CreateRevokedTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	err := testQueries.CreateRevokedToken(context.Background(), args)
+	require.NoError(t, err)
+
+	// revoking the same token twice is not an error
+	err = testQueries.CreateRevokedToken(context.Background(), args)
+	require.NoError(t, err)
+
+	revokedTokens, err := testQueries.ListRevokedTokens(context.Background())
+	require.NoError(t, err)
+	found := false
+	for _, revokedToken := range revokedTokens {
+		if revokedToken.ID == args.ID {
+			found = true
+			require.Equal(t, args.Username, revokedToken.Username)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestDeleteExpiredRevokedTokens(t *testing.T) {
+	user := CreateRandomUser(t)
+	args := CreateRevokedTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	err := testQueries.CreateRevokedToken(context.Background(), args)
+	require.NoError(t, err)
+
+	err = testQueries.DeleteExpiredRevokedTokens(context.Background())
+	require.NoError(t, err)
+
+	revokedTokens, err := testQueries.ListRevokedTokens(context.Background())
+	require.NoError(t, err)
+	for _, revokedToken := range revokedTokens {
+		require.NotEqual(t, args.ID, revokedToken.ID)
+	}
+}
+
+func TestUpsertUserRevocation(t *testing.T) {
+	user := CreateRandomUser(t)
+	args := UpsertUserRevocationParams{
+		Username:      user.Username,
+		RevokedBefore: time.Now(),
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+	revocation1, err := testQueries.UpsertUserRevocation(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.Username, revocation1.Username)
+	require.WithinDuration(t, args.RevokedBefore, revocation1.RevokedBefore, time.Second)
+
+	args.RevokedBefore = time.Now().Add(time.Minute)
+	revocation2, err := testQueries.UpsertUserRevocation(context.Background(), args)
+	require.NoError(t, err)
+	require.WithinDuration(t, args.RevokedBefore, revocation2.RevokedBefore, time.Second)
+
+	err = testQueries.DeleteExpiredUserRevocations(context.Background())
+	require.NoError(t, err)
+	revocations, err := testQueries.ListUserRevocations(context.Background())
+	require.NoError(t, err)
+	require.NotEmpty(t, revocations)
+}
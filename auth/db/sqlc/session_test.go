@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomSession(t *testing.T) Session {
+	user := CreateRandomUser(t)
+	args := CreateSessionParams{
+		ID:           uuid.New(),
+		Username:     user.Username,
+		RefreshToken: utils.RandomString(32),
+		UserAgent:    utils.RandomString(10),
+		ClientIp:     "127.0.0.1",
+		IsBlocked:    false,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	session, err := testQueries.CreateSession(context.Background(), args)
+	require.NoError(t, err)
+	require.NotEmpty(t, session)
+	require.Equal(t, args.ID, session.ID)
+	require.Equal(t, args.Username, session.Username)
+	require.Equal(t, args.RefreshToken, session.RefreshToken)
+	require.Equal(t, args.UserAgent, session.UserAgent)
+	require.Equal(t, args.ClientIp, session.ClientIp)
+	require.False(t, session.IsBlocked)
+	require.WithinDuration(t, args.ExpiresAt, session.ExpiresAt, time.Second)
+	require.WithinDuration(t, session.CreatedAt, time.Now(), time.Minute)
+
+	return session
+}
+
+func TestCreateSession(t *testing.T) {
+	CreateRandomSession(t)
+}
+
+func TestGetSession(t *testing.T) {
+	session1 := CreateRandomSession(t)
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+
+	require.NoError(t, err)
+	require.Equal(t, session1.ID, session2.ID)
+	require.Equal(t, session1.Username, session2.Username)
+	require.Equal(t, session1.RefreshToken, session2.RefreshToken)
+	require.WithinDuration(t, session1.ExpiresAt, session2.ExpiresAt, time.Second)
+}
+
+func TestBlockSession(t *testing.T) {
+	session1 := CreateRandomSession(t)
+	err := testQueries.BlockSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.True(t, session2.IsBlocked)
+}
+
+func TestBlockUserSessions(t *testing.T) {
+	session1 := CreateRandomSession(t)
+	err := testQueries.BlockUserSessions(context.Background(), session1.Username)
+	require.NoError(t, err)
+
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.True(t, session2.IsBlocked)
+}
+
+func TestListUserSessions(t *testing.T) {
+	session1 := CreateRandomSession(t)
+	require.WithinDuration(t, session1.CreatedAt, session1.LastSeenAt, time.Second)
+	session2, err := testQueries.CreateSession(context.Background(), CreateSessionParams{
+		ID:           uuid.New(),
+		Username:     session1.Username,
+		RefreshToken: utils.RandomString(32),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	// the most recently used session comes first
+	err = testQueries.TouchSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	sessions, err := testQueries.ListUserSessions(context.Background(), session1.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, session1.ID, sessions[0].ID)
+	require.Equal(t, session2.ID, sessions[1].ID)
+
+	// blocked sessions are left out
+	err = testQueries.BlockSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	sessions, err = testQueries.ListUserSessions(context.Background(), session1.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, session2.ID, sessions[0].ID)
+}
+
+func TestListAllUserSessions(t *testing.T) {
+	session1 := CreateRandomSession(t)
+	session2, err := testQueries.CreateSession(context.Background(), CreateSessionParams{
+		ID:           uuid.New(),
+		Username:     session1.Username,
+		RefreshToken: utils.RandomString(32),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	// blocked sessions are kept, the newest comes first
+	err = testQueries.BlockSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	sessions, err := testQueries.ListAllUserSessions(context.Background(), session1.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, session2.ID, sessions[0].ID)
+	require.Equal(t, session1.ID, sessions[1].ID)
+	require.True(t, sessions[1].IsBlocked)
+}
@@ -1,11 +1,17 @@
 package db
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
 
 // Store provides all functions to execute db queries and transactions
 type Store interface {
 	Querier
-	// add transactional or other extra functions
+	DeleteAccountTx(ctx context.Context, arg DeleteAccountTxParams) (User, error)
+	RenameUserTx(ctx context.Context, arg RenameUserTxParams) (User, error)
 }
 
 // SQLStore provides all functions to execute SQL queries and transactions
@@ -21,3 +27,78 @@ func NewStore(db *sql.DB) Store {
 		Queries: New(db),
 	}
 }
+
+// execTx executes a function within a database transaction
+func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(New(tx))
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAccountTxParams contains the input parameters of DeleteAccountTx
+type DeleteAccountTxParams struct {
+	Username string
+	// AfterDelete runs before the transaction commits, the account stays when it fails
+	AfterDelete func(user User) error
+}
+
+// DeleteAccountTx removes an account whose deletion is due along with
+// everything that hangs off it. It returns sql.ErrNoRows when the deletion is
+// not due, like when the owner called it off in the meantime.
+func (store *SQLStore) DeleteAccountTx(ctx context.Context, arg DeleteAccountTxParams) (User, error) {
+	var user User
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		user, err = q.DeleteDueUser(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+		return arg.AfterDelete(user)
+	})
+	return user, err
+}
+
+// RenameUserTxParams contains the input parameters of RenameUserTx
+type RenameUserTxParams struct {
+	Username    string
+	NewUsername string
+	// ReservedUntil is until when nobody else can take the old username
+	ReservedUntil time.Time
+	// AfterRename runs before the transaction commits, the old name stays when it fails
+	AfterRename func(user User) error
+}
+
+// RenameUserTx changes the username of a user, everything that hangs off
+// them follows, and records the old name in their history
+func (store *SQLStore) RenameUserTx(ctx context.Context, arg RenameUserTxParams) (User, error) {
+	var user User
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		user, err = q.RenameUser(ctx, RenameUserParams{
+			NewUsername: arg.NewUsername,
+			Username:    arg.Username,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.CreateUsernameChange(ctx, CreateUsernameChangeParams{
+			OldUsername:   arg.Username,
+			Username:      arg.NewUsername,
+			ReservedUntil: arg.ReservedUntil,
+		})
+		if err != nil {
+			return err
+		}
+		return arg.AfterRename(user)
+	})
+	return user, err
+}
@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -16,19 +17,21 @@ INSERT INTO users (
 	password,
 	about,
 	photo,
-	role
+	role,
+	email
 ) VALUES (
-	$1, $2, $3, $4, $5, $6
-) RETURNING username, name, password, about, photo, role, created_at
+	$1, $2, $3, $4, $5, $6, $7
+) RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
 `
 
 type CreateUserParams struct {
-	Username string `json:"username"`
-	Name     string `json:"name"`
-	Password string `json:"password"`
-	About    string `json:"about"`
-	Photo    string `json:"photo"`
-	Role     string `json:"role"`
+	Username string         `json:"username"`
+	Name     string         `json:"name"`
+	Password string         `json:"password"`
+	About    string         `json:"about"`
+	Photo    string         `json:"photo"`
+	Role     string         `json:"role"`
+	Email    sql.NullString `json:"email"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -39,7 +42,64 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.About,
 		arg.Photo,
 		arg.Role,
+		arg.Email,
+	)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const disableUserTotp = `-- name: DisableUserTotp :one
+UPDATE users SET totp_secret=NULL, totp_enabled=false, totp_last_counter=0
+WHERE username=$1
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+func (q *Queries) DisableUserTotp(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, disableUserTotp, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
+	return i, err
+}
+
+const enableUserTotp = `-- name: EnableUserTotp :one
+UPDATE users SET totp_enabled=true
+WHERE username=$1 AND totp_secret IS NOT NULL
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+func (q *Queries) EnableUserTotp(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableUserTotp, username)
 	var i User
 	err := row.Scan(
 		&i.Username,
@@ -49,12 +109,19 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Photo,
 		&i.Role,
 		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT username, name, password, about, photo, role, created_at FROM users
+SELECT username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id FROM users
 WHERE username=$1 LIMIT 1
 `
 
@@ -69,12 +136,128 @@ func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 		&i.Photo,
 		&i.Role,
 		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id FROM users
+WHERE email=$1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const rehashPassword = `-- name: RehashPassword :exec
+UPDATE users SET password=$1
+WHERE username=$2 AND password=$3
+`
+
+type RehashPasswordParams struct {
+	NewPassword string `json:"new_password"`
+	Username    string `json:"username"`
+	OldPassword string `json:"old_password"`
+}
+
+func (q *Queries) RehashPassword(ctx context.Context, arg RehashPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashPassword, arg.NewPassword, arg.Username, arg.OldPassword)
+	return err
+}
+
+const renameUser = `-- name: RenameUser :one
+UPDATE users SET username=$1
+WHERE username=$2
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+type RenameUserParams struct {
+	NewUsername string `json:"new_username"`
+	Username    string `json:"username"`
+}
+
+func (q *Queries) RenameUser(ctx context.Context, arg RenameUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, renameUser, arg.NewUsername, arg.Username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const setUserTotpSecret = `-- name: SetUserTotpSecret :one
+UPDATE users SET totp_secret=$2, totp_enabled=false, totp_last_counter=0
+WHERE username=$1 AND totp_enabled=false
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+type SetUserTotpSecretParams struct {
+	Username   string         `json:"username"`
+	TotpSecret sql.NullString `json:"totp_secret"`
+}
+
+func (q *Queries) SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserTotpSecret, arg.Username, arg.TotpSecret)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
 	return i, err
 }
 
 const updatePassword = `-- name: UpdatePassword :one
-UPDATE users SET password=$1 WHERE username=$2 RETURNING username, name, password, about, photo, role, created_at
+UPDATE users SET password=$1 WHERE username=$2 RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
 `
 
 type UpdatePasswordParams struct {
@@ -93,12 +276,19 @@ func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams)
 		&i.Photo,
 		&i.Role,
 		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
 	return i, err
 }
 
 const updateRole = `-- name: UpdateRole :one
-UPDATE users SET role=$1 WHERE username=$2 RETURNING username, name, password, about, photo, role, created_at
+UPDATE users SET role=$1 WHERE username=$2 RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
 `
 
 type UpdateRoleParams struct {
@@ -117,12 +307,19 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (User, e
 		&i.Photo,
 		&i.Role,
 		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
-UPDATE users SET name=$1, about=$2, photo=$3 WHERE username=$4 RETURNING username, name, password, about, photo, role, created_at
+UPDATE users SET name=$1, about=$2, photo=$3 WHERE username=$4 RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
 `
 
 type UpdateUserParams struct {
@@ -148,6 +345,112 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Photo,
 		&i.Role,
 		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const updateUserMfaRequired = `-- name: UpdateUserMfaRequired :one
+UPDATE users SET mfa_required=$2
+WHERE username=$1
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+type UpdateUserMfaRequiredParams struct {
+	Username    string `json:"username"`
+	MfaRequired bool   `json:"mfa_required"`
+}
+
+func (q *Queries) UpdateUserMfaRequired(ctx context.Context, arg UpdateUserMfaRequiredParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserMfaRequired, arg.Username, arg.MfaRequired)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const updateUserTotpCounter = `-- name: UpdateUserTotpCounter :one
+UPDATE users SET totp_last_counter=$2
+WHERE username=$1 AND totp_last_counter < $2
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+type UpdateUserTotpCounterParams struct {
+	Username        string `json:"username"`
+	TotpLastCounter int64  `json:"totp_last_counter"`
+}
+
+func (q *Queries) UpdateUserTotpCounter(ctx context.Context, arg UpdateUserTotpCounterParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserTotpCounter, arg.Username, arg.TotpLastCounter)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users SET email_verified=true
+WHERE username=$1 AND email=$2
+RETURNING username, name, password, about, photo, role, created_at, email, email_verified, totp_secret, totp_enabled, totp_last_counter, mfa_required, id
+`
+
+type VerifyUserEmailParams struct {
+	Username string         `json:"username"`
+	Email    sql.NullString `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Username, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.Name,
+		&i.Password,
+		&i.About,
+		&i.Photo,
+		&i.Role,
+		&i.CreatedAt,
+		&i.Email,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.MfaRequired,
+		&i.ID,
 	)
 	return i, err
 }
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomUserIdentity(t *testing.T) UserIdentity {
+	user := CreateRandomUser(t)
+	args := CreateUserIdentityParams{
+		Provider: utils.RandomString(6),
+		Subject:  utils.RandomString(12),
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	identity, err := testQueries.CreateUserIdentity(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.Provider, identity.Provider)
+	require.Equal(t, args.Subject, identity.Subject)
+	require.Equal(t, args.Username, identity.Username)
+	require.Equal(t, args.Email, identity.Email)
+	require.NotZero(t, identity.CreatedAt)
+
+	return identity
+}
+
+func TestCreateUserIdentity(t *testing.T) {
+	identity := CreateRandomUserIdentity(t)
+
+	// a subject of a provider links to one user only
+	user := CreateRandomUser(t)
+	_, err := testQueries.CreateUserIdentity(context.Background(), CreateUserIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Username: user.Username,
+	})
+	require.Error(t, err)
+}
+
+func TestGetUserIdentity(t *testing.T) {
+	identity1 := CreateRandomUserIdentity(t)
+	identity2, err := testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Provider: identity1.Provider,
+		Subject:  identity1.Subject,
+	})
+	require.NoError(t, err)
+	require.Equal(t, identity1.Username, identity2.Username)
+	require.Equal(t, identity1.Email, identity2.Email)
+	require.WithinDuration(t, identity1.CreatedAt, identity2.CreatedAt, time.Second)
+
+	_, err = testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Provider: identity1.Provider,
+		Subject:  utils.RandomString(12),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ func CreateRandomUser(t *testing.T) User {
 		About:    utils.RandomString(30),
 		Photo:    utils.RandomString(9),
 		Password: utils.RandomString(15),
+		Email:    sql.NullString{String: utils.RandomEmail(), Valid: true},
 	}
 	user, err := testQueries.CreateUser(context.Background(), args)
 	require.NoError(t, err)
@@ -27,6 +29,8 @@ func CreateRandomUser(t *testing.T) User {
 	require.Equal(t, args.About, user.About)
 	require.Equal(t, args.Photo, user.Photo)
 	require.Equal(t, args.Password, user.Password)
+	require.Equal(t, args.Email, user.Email)
+	require.False(t, user.EmailVerified)
 	require.WithinDuration(t, user.CreatedAt, time.Now(), time.Minute)
 
 	return user
@@ -74,6 +78,31 @@ func TestUpdatePassword(t *testing.T) {
 	require.Equal(t, user2.Username, args.Username)
 }
 
+func TestRehashPassword(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	args := RehashPasswordParams{
+		NewPassword: utils.RandomString(12),
+		Username:    user1.Username,
+		OldPassword: user1.Password,
+	}
+	err := testQueries.RehashPassword(context.Background(), args)
+	require.NoError(t, err)
+	user2, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, args.NewPassword, user2.Password)
+
+	// a password changed in the meantime is kept
+	err = testQueries.RehashPassword(context.Background(), RehashPasswordParams{
+		NewPassword: utils.RandomString(12),
+		Username:    user1.Username,
+		OldPassword: user1.Password,
+	})
+	require.NoError(t, err)
+	user3, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, args.NewPassword, user3.Password)
+}
+
 func TestUpdateRole(t *testing.T) {
 	user1 := CreateRandomUser(t)
 	args := UpdateRoleParams{
@@ -86,3 +115,91 @@ func TestUpdateRole(t *testing.T) {
 	require.Equal(t, user2.Username, args.Username)
 	require.Equal(t, user2.Role, args.Role)
 }
+
+func TestVerifyUserEmail(t *testing.T) {
+	user1 := CreateRandomUser(t)
+
+	// a link sent to a previous address does not verify the current one
+	_, err := testQueries.VerifyUserEmail(context.Background(), VerifyUserEmailParams{
+		Username: user1.Username,
+		Email:    sql.NullString{String: utils.RandomEmail(), Valid: true},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	user2, err := testQueries.VerifyUserEmail(context.Background(), VerifyUserEmailParams{
+		Username: user1.Username,
+		Email:    user1.Email,
+	})
+	require.NoError(t, err)
+	require.True(t, user2.EmailVerified)
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	user2, err := testQueries.GetUserByEmail(context.Background(), user1.Email)
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, user2.Username)
+
+	_, err = testQueries.GetUserByEmail(context.Background(), sql.NullString{String: utils.RandomEmail(), Valid: true})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUserTotp(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	require.False(t, user1.TotpEnabled)
+	require.False(t, user1.TotpSecret.Valid)
+
+	// nothing to enable before a secret is set
+	_, err := testQueries.EnableUserTotp(context.Background(), user1.Username)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	secret := sql.NullString{String: utils.RandomString(32), Valid: true}
+	user2, err := testQueries.SetUserTotpSecret(context.Background(), SetUserTotpSecretParams{
+		Username:   user1.Username,
+		TotpSecret: secret,
+	})
+	require.NoError(t, err)
+	require.Equal(t, secret, user2.TotpSecret)
+	require.False(t, user2.TotpEnabled)
+
+	user2, err = testQueries.EnableUserTotp(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.True(t, user2.TotpEnabled)
+
+	// an enabled secret cannot be replaced
+	_, err = testQueries.SetUserTotpSecret(context.Background(), SetUserTotpSecretParams{
+		Username:   user1.Username,
+		TotpSecret: sql.NullString{String: utils.RandomString(32), Valid: true},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	args := UpdateUserTotpCounterParams{
+		Username:        user1.Username,
+		TotpLastCounter: time.Now().Unix() / 30,
+	}
+	user2, err = testQueries.UpdateUserTotpCounter(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.TotpLastCounter, user2.TotpLastCounter)
+
+	// codes cannot be replayed
+	_, err = testQueries.UpdateUserTotpCounter(context.Background(), args)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	user2, err = testQueries.DisableUserTotp(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.False(t, user2.TotpEnabled)
+	require.False(t, user2.TotpSecret.Valid)
+	require.Zero(t, user2.TotpLastCounter)
+}
+
+func TestUpdateUserMfaRequired(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	require.False(t, user1.MfaRequired)
+
+	user2, err := testQueries.UpdateUserMfaRequired(context.Background(), UpdateUserMfaRequiredParams{
+		Username:    user1.Username,
+		MfaRequired: true,
+	})
+	require.NoError(t, err)
+	require.True(t, user2.MfaRequired)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func CreateRandomUserToken(t *testing.T, expiresAt time.Time) UserToken {
+	user := CreateRandomUser(t)
+	args := CreateUserTokenParams{
+		TokenHash: utils.RandomString(64),
+		Username:  user.Username,
+		Purpose:   "verify_email",
+		Email:     user.Email,
+		ExpiresAt: expiresAt,
+	}
+	userToken, err := testQueries.CreateUserToken(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.TokenHash, userToken.TokenHash)
+	require.Equal(t, args.Username, userToken.Username)
+	require.Equal(t, args.Purpose, userToken.Purpose)
+	require.Equal(t, args.Email, userToken.Email)
+	require.WithinDuration(t, args.ExpiresAt, userToken.ExpiresAt, time.Second)
+	require.False(t, userToken.UsedAt.Valid)
+
+	return userToken
+}
+
+func TestCreateUserToken(t *testing.T) {
+	CreateRandomUserToken(t, time.Now().Add(time.Hour))
+}
+
+func TestUseUserToken(t *testing.T) {
+	userToken := CreateRandomUserToken(t, time.Now().Add(time.Hour))
+	args := UseUserTokenParams{
+		TokenHash: userToken.TokenHash,
+		Purpose:   userToken.Purpose,
+	}
+
+	// tokens only work for their own purpose
+	_, err := testQueries.UseUserToken(context.Background(), UseUserTokenParams{
+		TokenHash: userToken.TokenHash,
+		Purpose:   "reset_password",
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// looking a token up does not use it
+	found, err := testQueries.GetUserToken(context.Background(), GetUserTokenParams(args))
+	require.NoError(t, err)
+	require.Equal(t, userToken.Username, found.Username)
+
+	used, err := testQueries.UseUserToken(context.Background(), args)
+	require.NoError(t, err)
+	require.True(t, used.UsedAt.Valid)
+
+	// and only once
+	_, err = testQueries.UseUserToken(context.Background(), args)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testQueries.GetUserToken(context.Background(), GetUserTokenParams(args))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseExpiredUserToken(t *testing.T) {
+	userToken := CreateRandomUserToken(t, time.Now().Add(-time.Minute))
+	_, err := testQueries.UseUserToken(context.Background(), UseUserTokenParams{
+		TokenHash: userToken.TokenHash,
+		Purpose:   userToken.Purpose,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
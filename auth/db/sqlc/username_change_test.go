@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestRenameUserTx(t *testing.T) {
+	store := NewStore(testDB)
+	session := CreateRandomSession(t)
+	oldUsername := session.Username
+	newUsername := utils.RandomString(8)
+	rename := func(username string, newUsername string, afterRename func(User) error) (User, error) {
+		return store.RenameUserTx(context.Background(), RenameUserTxParams{
+			Username:      username,
+			NewUsername:   newUsername,
+			ReservedUntil: time.Now().Add(time.Hour),
+			AfterRename:   afterRename,
+		})
+	}
+
+	// the old name stays when AfterRename fails
+	_, err := rename(oldUsername, newUsername, func(User) error { return errors.New("broker is down") })
+	require.Error(t, err)
+	_, err = testQueries.GetUser(context.Background(), oldUsername)
+	require.NoError(t, err)
+	_, err = testQueries.GetUsernameReservation(context.Background(), oldUsername)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	user, err := rename(oldUsername, newUsername, func(user User) error {
+		require.Equal(t, newUsername, user.Username)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, newUsername, user.Username)
+	_, err = testQueries.GetUser(context.Background(), oldUsername)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// what hangs off the user follows the new name
+	session, err = testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.Equal(t, newUsername, session.Username)
+
+	reservation, err := testQueries.GetUsernameReservation(context.Background(), oldUsername)
+	require.NoError(t, err)
+	require.Equal(t, newUsername, reservation.Username)
+
+	// the history always points at the current name
+	latestUsername := utils.RandomString(8)
+	_, err = rename(newUsername, latestUsername, func(User) error { return nil })
+	require.NoError(t, err)
+	changes, err := testQueries.ListUsernameChanges(context.Background(), latestUsername)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, newUsername, changes[0].OldUsername)
+	require.Equal(t, oldUsername, changes[1].OldUsername)
+	reservation, err = testQueries.GetUsernameReservation(context.Background(), oldUsername)
+	require.NoError(t, err)
+	require.Equal(t, latestUsername, reservation.Username)
+
+	// taken names are refused
+	other := CreateRandomUser(t)
+	_, err = rename(latestUsername, other.Username, func(User) error { return nil })
+	require.Error(t, err)
+}
+
+func TestUsernameReservationExpires(t *testing.T) {
+	user := CreateRandomUser(t)
+	oldUsername := utils.RandomString(8)
+	_, err := testQueries.CreateUsernameChange(context.Background(), CreateUsernameChangeParams{
+		OldUsername:   oldUsername,
+		Username:      user.Username,
+		ReservedUntil: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	// once the reservation is over the old name is free and points nowhere
+	_, err = testQueries.GetUsernameReservation(context.Background(), oldUsername)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
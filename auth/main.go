@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"shivesh-ranjan.github.io/m/api"
 	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/notify"
 	"shivesh-ranjan.github.io/m/utils"
 )
 
@@ -33,19 +37,48 @@ func main() {
 		log.Print("While hashing Admin Password: ", err)
 	}
 	store := db.NewStore(conn)
-	user, err := db.Store.CreateUser(store, context.Background(), args)
-	if err != nil {
-		log.Print("This happened during Admin Creation: ", err)
+	// an admin who changed their username is not created again under the old one while it is reserved
+	if reservation, err := store.GetUsernameReservation(context.Background(), args.Username); err == nil {
+		log.Print("Admin User was renamed to: ", reservation.Username)
 	} else {
-		log.Print("Admin User Added Successfully: ", user.Username)
+		user, err := db.Store.CreateUser(store, context.Background(), args)
+		if err != nil {
+			log.Print("This happened during Admin Creation: ", err)
+		} else {
+			log.Print("Admin User Added Successfully: ", user.Username)
+		}
 	}
 
-	server, err := api.NewServer(config, store)
+	notifier := notify.NewRabbitMQNotifier(config.AMQPURL, config.NotificationExchange, config.NotificationRoutingKey)
+	defer notifier.Close()
+
+	server, err := api.NewServer(config, store, notifier)
 	if err != nil {
 		log.Fatal("cannot create server:", err)
 	}
+	go rotateKeysOnHangup(server)
+
 	err = server.Start(config.ServerAddress)
 	if err != nil {
 		log.Fatal("cannot start server:", err)
 	}
 }
+
+// rotateKeysOnHangup reloads the token keys from the config whenever the process gets SIGHUP
+func rotateKeysOnHangup(server *api.Server) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		config, err := utils.ReloadConfig()
+		if err != nil {
+			log.Print("Can't reload config: ", err)
+			continue
+		}
+		err = server.RotateKeys(config)
+		if err != nil {
+			log.Print("Can't rotate token keys: ", err)
+			continue
+		}
+		log.Print("Token keys rotated")
+	}
+}
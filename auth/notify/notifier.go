@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Message types understood by the notification service
+const (
+	TypeEmailVerification        = "email_verification"
+	TypePasswordReset            = "password_reset"
+	TypePasswordChanged          = "password_changed"
+	TypeNewSignIn                = "new_sign_in"
+	TypeMagicLink                = "magic_link"
+	TypeAccountDeletionScheduled = "account_deletion_scheduled"
+)
+
+// Message is what the notification service consumes from RabbitMQ
+type Message struct {
+	Type    string   `json:"type"`
+	Email   string   `json:"email"`
+	Links   []string `json:"links"`
+	Summary string   `json:"summary"`
+}
+
+// Events other services can subscribe to, the type doubles as the routing key
+const (
+	EventUserDeleted = "user.deleted"
+	EventUserRenamed = "user.renamed"
+)
+
+// Event tells other services that something happened to an account
+type Event struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	// OldUsername is the name the user had before a rename
+	OldUsername string    `json:"old_username,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// Notifier delivers messages to users and announces account events to other services
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+	Publish(ctx context.Context, event Event) error
+}
+
+// RabbitMQNotifier publishes messages to the topic exchange the notification
+// service is bound to. The connection is reopened when the broker drops it.
+type RabbitMQNotifier struct {
+	url        string
+	exchange   string
+	routingKey string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+}
+
+// NewRabbitMQNotifier returns a notifier for the exchange. It connects on the
+// first message, so the service starts while RabbitMQ is still down.
+func NewRabbitMQNotifier(url string, exchange string, routingKey string) *RabbitMQNotifier {
+	return &RabbitMQNotifier{
+		url:        url,
+		exchange:   exchange,
+		routingKey: routingKey,
+	}
+}
+
+// channel opens a channel, connecting and declaring the exchange first when
+// there is no open connection
+func (notifier *RabbitMQNotifier) channel() (*amqp.Channel, error) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.conn != nil && !notifier.conn.IsClosed() {
+		return notifier.conn.Channel()
+	}
+	conn, err := amqp.Dial(notifier.url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to RabbitMQ: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = ch.ExchangeDeclare(notifier.exchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot declare exchange: %w", err)
+	}
+	notifier.conn = conn
+	return ch, nil
+}
+
+// reset drops the connection, the next channel reconnects
+func (notifier *RabbitMQNotifier) reset() {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.conn != nil {
+		notifier.conn.Close()
+		notifier.conn = nil
+	}
+}
+
+// Notify publishes msg as a persistent JSON message
+func (notifier *RabbitMQNotifier) Notify(ctx context.Context, msg Message) error {
+	return notifier.publish(notifier.routingKey, msg)
+}
+
+// Publish publishes event as a persistent JSON message routed by its type, so
+// services bind to the events they care about, like user.* for all of them
+func (notifier *RabbitMQNotifier) Publish(ctx context.Context, event Event) error {
+	return notifier.publish(event.Type, event)
+}
+
+func (notifier *RabbitMQNotifier) publish(routingKey string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = notifier.tryPublish(routingKey, body)
+	if err != nil {
+		// the broker may have dropped a connection that still looks open
+		notifier.reset()
+		err = notifier.tryPublish(routingKey, body)
+	}
+	return err
+}
+
+func (notifier *RabbitMQNotifier) tryPublish(routingKey string, body []byte) error {
+	ch, err := notifier.channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return ch.Publish(notifier.exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+// Close closes the connection to RabbitMQ
+func (notifier *RabbitMQNotifier) Close() error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.conn == nil || notifier.conn.IsClosed() {
+		return nil
+	}
+	return notifier.conn.Close()
+}
@@ -0,0 +1,193 @@
+// Package oidctest runs a minimal OpenID Connect provider for tests, so the
+// login flow can be exercised without the network
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// User is who the issuer signs in on the next authorization request
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// authorization is an issued authorization code waiting to be redeemed
+type authorization struct {
+	user          User
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+}
+
+// Issuer is an OpenID Connect provider accepting a single client. Every
+// authorization request is approved right away for the current user.
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	jwk token.JSONWebKey
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authorization
+}
+
+// NewIssuer starts an issuer that is shut down when the test ends
+func NewIssuer(t testing.TB, clientID string, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwk, err := token.NewJSONWebKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		jwk:          jwk,
+		codes:        make(map[string]authorization),
+	}
+	router := gin.New()
+	router.GET("/.well-known/openid-configuration", issuer.discovery)
+	router.GET("/authorize", issuer.authorize)
+	router.POST("/token", issuer.token)
+	router.GET("/jwks", issuer.jwks)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	issuer.URL = server.URL
+	return issuer
+}
+
+// SetUser changes who is signed in on the next authorization request
+func (issuer *Issuer) SetUser(user User) {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	issuer.user = user
+}
+
+func (issuer *Issuer) discovery(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer.URL,
+		"authorization_endpoint":                issuer.URL + "/authorize",
+		"token_endpoint":                        issuer.URL + "/token",
+		"jwks_uri":                              issuer.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (issuer *Issuer) jwks(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, token.JSONWebKeySet{Keys: []token.JSONWebKey{issuer.jwk}})
+}
+
+// authorize redirects back to the client with a code, as if the user had signed in
+func (issuer *Issuer) authorize(ctx *gin.Context) {
+	query := ctx.Request.URL.Query()
+	if query.Get("client_id") != issuer.ClientID ||
+		query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" ||
+		query.Get("code_challenge") == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+	code := randomString()
+
+	issuer.mu.Lock()
+	issuer.codes[code] = authorization{
+		user:          issuer.user,
+		nonce:         query.Get("nonce"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	issuer.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	ctx.Redirect(http.StatusFound, redirect.String())
+}
+
+// token redeems a code for a signed ID token
+func (issuer *Issuer) token(ctx *gin.Context) {
+	clientID, clientSecret, ok := ctx.Request.BasicAuth()
+	if !ok || clientID != issuer.ClientID || clientSecret != issuer.ClientSecret {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+	code := ctx.PostForm("code")
+	issuer.mu.Lock()
+	auth, ok := issuer.codes[code]
+	delete(issuer.codes, code)
+	issuer.mu.Unlock()
+	if !ok || ctx.PostForm("grant_type") != "authorization_code" || ctx.PostForm("redirect_uri") != auth.redirectURI {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	if oidc.CodeChallenge(ctx.PostForm("code_verifier")) != auth.codeChallenge {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer.URL,
+			Subject:   auth.user.Subject,
+			Audience:  jwt.ClaimStrings{issuer.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce:             auth.nonce,
+		Email:             auth.user.Email,
+		EmailVerified:     auth.user.EmailVerified,
+		Name:              auth.user.Name,
+		PreferredUsername: auth.user.PreferredUsername,
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = issuer.jwk.Kid
+	signed, err := idToken.SignedString(issuer.key)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
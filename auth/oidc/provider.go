@@ -0,0 +1,292 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+// scopes requested from every provider
+const scopes = "openid email profile"
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrNonceMismatch  = errors.New("ID token nonce does not match the login")
+)
+
+// metadata is the part of the discovery document of a provider we use,
+// see OpenID Connect Discovery 1.0
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of an ID token that identify the user
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// Provider signs users in with an external OpenID Connect provider using the
+// authorization code flow with PKCE. The discovery document and signing keys
+// are fetched on first use and cached, keys are refetched when an unknown kid shows up.
+type Provider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	httpClient   *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]crypto.PublicKey
+}
+
+// NewProvider creates a Provider redirecting users back to redirectURL
+func NewProvider(config utils.OIDCProvider, redirectURL string) *Provider {
+	return &Provider{
+		name:         config.Name,
+		issuer:       config.Issuer,
+		clientID:     config.ClientID,
+		clientSecret: config.ClientSecret,
+		redirectURL:  redirectURL,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the name the provider is configured under
+func (provider *Provider) Name() string {
+	return provider.name
+}
+
+// AuthCodeURL returns the URL of the provider the user is sent to for signing in
+func (provider *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	md, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.clientID)
+	query.Set("redirect_uri", provider.redirectURL)
+	query.Set("scope", scopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return md.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token. nonce is the one sent with the authorization request.
+func (provider *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Claims, error) {
+	md, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(provider.clientID), url.QueryEscape(provider.clientSecret))
+
+	response, err := provider.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach token endpoint: %w", err)
+	}
+	defer response.Body.Close()
+	var rsp tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&rsp); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint rejected the code: %s %s", rsp.Error, rsp.ErrorDescription)
+	}
+	if rsp.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+
+	claims, err := provider.verify(ctx, rsp.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// verify checks the signature, issuer, audience and expiry of an ID token
+func (provider *Provider) verify(ctx context.Context, rawIDToken string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(idToken *jwt.Token) (any, error) {
+		kid, _ := idToken.Header["kid"].(string)
+		return provider.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+	if claims.Issuer != provider.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !claims.VerifyAudience(provider.clientID, true) {
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	}
+	if claims.ExpiresAt == nil || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing exp or sub", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key returns the signing key with the given kid, refetching the key set
+// once when it is not known yet
+func (provider *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if key, ok := provider.lookupKey(kid); ok {
+		return key, nil
+	}
+	if err := provider.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := provider.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %s", kid)
+}
+
+// lookupKey finds a cached key, a token without kid matches a key set with a single key
+func (provider *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	key, ok := provider.keys[kid]
+	return key, ok
+}
+
+// fetchKeys replaces the cached keys with the JWKS of the provider, mu must be held
+func (provider *Provider) fetchKeys(ctx context.Context) error {
+	md, err := provider.discoverLocked(ctx)
+	if err != nil {
+		return err
+	}
+	var jwks token.JSONWebKeySet
+	if err := provider.getJSON(ctx, md.JWKSURI, &jwks); err != nil {
+		return fmt.Errorf("cannot fetch signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// keys of other types are skipped, tokens signed with them are rejected
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	provider.keys = keys
+	return nil
+}
+
+// discover returns the cached discovery document, fetching it on first use
+func (provider *Provider) discover(ctx context.Context) (*metadata, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return provider.discoverLocked(ctx)
+}
+
+func (provider *Provider) discoverLocked(ctx context.Context) (*metadata, error) {
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+	var md metadata
+	discoveryURL := strings.TrimSuffix(provider.issuer, "/") + "/.well-known/openid-configuration"
+	if err := provider.getJSON(ctx, discoveryURL, &md); err != nil {
+		return nil, fmt.Errorf("cannot discover %s: %w", provider.name, err)
+	}
+	if md.Issuer != provider.issuer {
+		return nil, fmt.Errorf("discovery document of %s is for issuer %s", provider.issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is incomplete", provider.issuer)
+	}
+	provider.metadata = &md
+	return provider.metadata, nil
+}
+
+func (provider *Provider) getJSON(ctx context.Context, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := provider.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// NewCodeVerifier generates a random PKCE code verifier, see RFC 7636
+func NewCodeVerifier() (string, error) {
+	verifier := make([]byte, 32)
+	if _, err := rand.Read(verifier); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(verifier), nil
+}
+
+// CodeChallenge derives the S256 code challenge of a code verifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/oidc"
+	"shivesh-ranjan.github.io/m/oidc/oidctest"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+const redirectURL = "http://localhost:8080/oidc/mock/callback"
+
+func newTestProvider(t *testing.T, issuer *oidctest.Issuer) *oidc.Provider {
+	return oidc.NewProvider(utils.OIDCProvider{
+		Name:         "mock",
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+	}, redirectURL)
+}
+
+// authorize follows the authorization URL like a browser would and returns
+// the query the issuer redirects back with
+func authorize(t *testing.T, authURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, redirectURL, location.Scheme+"://"+location.Host+location.Path)
+	return location.Query()
+}
+
+func TestProviderExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, "client", "secret")
+	issuer.SetUser(oidctest.User{Subject: "1234", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	provider := newTestProvider(t, issuer)
+	ctx := context.Background()
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", codeVerifier)
+	require.NoError(t, err)
+	callback := authorize(t, authURL)
+	require.Equal(t, "state", callback.Get("state"))
+
+	claims, err := provider.Exchange(ctx, callback.Get("code"), codeVerifier, "nonce")
+	require.NoError(t, err)
+	require.Equal(t, "1234", claims.Subject)
+	require.Equal(t, "alice@example.com", claims.Email)
+	require.True(t, claims.EmailVerified)
+	require.Equal(t, "Alice", claims.Name)
+
+	// codes are single use
+	_, err = provider.Exchange(ctx, callback.Get("code"), codeVerifier, "nonce")
+	require.Error(t, err)
+}
+
+func TestProviderExchangeChecks(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, "client", "secret")
+	issuer.SetUser(oidctest.User{Subject: "1234"})
+	provider := newTestProvider(t, issuer)
+	ctx := context.Background()
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", codeVerifier)
+	require.NoError(t, err)
+
+	// the code is bound to the PKCE verifier of the login
+	otherVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	_, err = provider.Exchange(ctx, authorize(t, authURL).Get("code"), otherVerifier, "nonce")
+	require.Error(t, err)
+
+	// and the ID token to its nonce
+	_, err = provider.Exchange(ctx, authorize(t, authURL).Get("code"), codeVerifier, "other")
+	require.ErrorIs(t, err, oidc.ErrNonceMismatch)
+
+	// the client has to authenticate with its secret
+	wrongSecret := oidc.NewProvider(utils.OIDCProvider{
+		Name:         "mock",
+		Issuer:       issuer.URL,
+		ClientID:     "client",
+		ClientSecret: "wrong",
+	}, redirectURL)
+	_, err = wrongSecret.Exchange(ctx, authorize(t, authURL).Get("code"), codeVerifier, "nonce")
+	require.Error(t, err)
+}
+
+func TestProviderDiscoveryFailure(t *testing.T) {
+	provider := oidc.NewProvider(utils.OIDCProvider{
+		Name:     "down",
+		Issuer:   "http://127.0.0.1:1",
+		ClientID: "client",
+	}, redirectURL)
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.Error(t, err)
+}
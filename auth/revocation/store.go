@@ -0,0 +1,170 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+)
+
+// Querier is the part of db.Store the revocation list is persisted with
+type Querier interface {
+	CreateRevokedToken(ctx context.Context, arg db.CreateRevokedTokenParams) error
+	ListRevokedTokens(ctx context.Context) ([]db.RevokedToken, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	UpsertUserRevocation(ctx context.Context, arg db.UpsertUserRevocationParams) (db.UserRevocation, error)
+	ListUserRevocations(ctx context.Context) ([]db.UserRevocation, error)
+	DeleteExpiredUserRevocations(ctx context.Context) error
+}
+
+// Store keeps track of tokens invalidated before they expire.
+// Revocations are written to Postgres and mirrored in memory, so checking a
+// token never needs a database round trip. Sync reloads the cache to pick up
+// revocations made by other replicas and prunes the expired entries.
+type Store struct {
+	querier Querier
+
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]struct{}
+	users  map[string]db.UserRevocation
+}
+
+// NewStore creates a new revocation Store
+func NewStore(querier Querier) *Store {
+	return &Store{
+		querier: querier,
+		tokens:  make(map[uuid.UUID]struct{}),
+		users:   make(map[string]db.UserRevocation),
+	}
+}
+
+// RevokeToken invalidates a single token until it expires
+func (store *Store) RevokeToken(ctx context.Context, payload *token.Payload) error {
+	return store.revoke(ctx, payload.ID, payload.Username, payload.ExpiredAt)
+}
+
+// RevokeSession invalidates the refresh token of a session and every access
+// token issued for it. The session ID is also the ID of its refresh token.
+func (store *Store) RevokeSession(ctx context.Context, session db.Session) error {
+	return store.revoke(ctx, session.ID, session.Username, session.ExpiresAt)
+}
+
+func (store *Store) revoke(ctx context.Context, id uuid.UUID, username string, expiresAt time.Time) error {
+	err := store.querier.CreateRevokedToken(ctx, db.CreateRevokedTokenParams{
+		ID:        id,
+		Username:  username,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.tokens[id] = struct{}{}
+	return nil
+}
+
+// RevokeUser invalidates every user token issued to username before the
+// current second. Tokens carry their issue time in whole seconds, so the ones
+// issued within it are told apart from those issued right after and stay valid.
+// Service tokens carry the client ID where user tokens carry the username, a
+// client named like the user keeps its tokens.
+// maxTokenLifetime is how long the longest lived of those tokens can still be valid.
+func (store *Store) RevokeUser(ctx context.Context, username string, maxTokenLifetime time.Duration) error {
+	now := time.Now().Truncate(time.Second)
+	revocation, err := store.querier.UpsertUserRevocation(ctx, db.UpsertUserRevocationParams{
+		Username:      username,
+		RevokedBefore: now,
+		ExpiresAt:     now.Add(maxTokenLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.users[username] = revocation
+	return nil
+}
+
+// IsRevoked reports whether the token, or the session it was issued for,
+// was revoked before its expiry
+func (store *Store) IsRevoked(payload *token.Payload) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if _, ok := store.tokens[payload.ID]; ok {
+		return true
+	}
+	if payload.SessionID != nil {
+		if _, ok := store.tokens[*payload.SessionID]; ok {
+			return true
+		}
+	}
+	if payload.IsService() {
+		return false
+	}
+	revocation, ok := store.users[payload.Username]
+	return ok && payload.IssuedAt.Before(revocation.RevokedBefore)
+}
+
+// IsTokenRevoked reports whether a single token was revoked, ignoring user wide revocations
+func (store *Store) IsTokenRevoked(id uuid.UUID) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	_, ok := store.tokens[id]
+	return ok
+}
+
+// Sync prunes the expired revocations and reloads the cache from the database
+func (store *Store) Sync(ctx context.Context) error {
+	if err := store.querier.DeleteExpiredRevokedTokens(ctx); err != nil {
+		return err
+	}
+	if err := store.querier.DeleteExpiredUserRevocations(ctx); err != nil {
+		return err
+	}
+	revokedTokens, err := store.querier.ListRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	userRevocations, err := store.querier.ListUserRevocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[uuid.UUID]struct{}, len(revokedTokens))
+	for _, revokedToken := range revokedTokens {
+		tokens[revokedToken.ID] = struct{}{}
+	}
+	users := make(map[string]db.UserRevocation, len(userRevocations))
+	for _, revocation := range userRevocations {
+		users[revocation.Username] = revocation
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.tokens = tokens
+	store.users = users
+	return nil
+}
+
+// Run syncs the store every interval until ctx is done
+func (store *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := store.Sync(ctx); err != nil {
+			log.Print("Can't sync token revocations: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
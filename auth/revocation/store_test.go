@@ -0,0 +1,146 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	db "shivesh-ranjan.github.io/m/db/sqlc"
+	"shivesh-ranjan.github.io/m/token"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+// memoryQuerier stands in for Postgres in the tests
+type memoryQuerier struct {
+	tokens map[uuid.UUID]db.RevokedToken
+	users  map[string]db.UserRevocation
+}
+
+func newMemoryQuerier() *memoryQuerier {
+	return &memoryQuerier{
+		tokens: make(map[uuid.UUID]db.RevokedToken),
+		users:  make(map[string]db.UserRevocation),
+	}
+}
+
+func (q *memoryQuerier) CreateRevokedToken(ctx context.Context, arg db.CreateRevokedTokenParams) error {
+	q.tokens[arg.ID] = db.RevokedToken{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}
+	return nil
+}
+
+func (q *memoryQuerier) ListRevokedTokens(ctx context.Context) ([]db.RevokedToken, error) {
+	items := []db.RevokedToken{}
+	for _, revokedToken := range q.tokens {
+		items = append(items, revokedToken)
+	}
+	return items, nil
+}
+
+func (q *memoryQuerier) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	for id, revokedToken := range q.tokens {
+		if !revokedToken.ExpiresAt.After(time.Now()) {
+			delete(q.tokens, id)
+		}
+	}
+	return nil
+}
+
+func (q *memoryQuerier) UpsertUserRevocation(ctx context.Context, arg db.UpsertUserRevocationParams) (db.UserRevocation, error) {
+	q.users[arg.Username] = db.UserRevocation(arg)
+	return q.users[arg.Username], nil
+}
+
+func (q *memoryQuerier) ListUserRevocations(ctx context.Context) ([]db.UserRevocation, error) {
+	items := []db.UserRevocation{}
+	for _, revocation := range q.users {
+		items = append(items, revocation)
+	}
+	return items, nil
+}
+
+func (q *memoryQuerier) DeleteExpiredUserRevocations(ctx context.Context) error {
+	for username, revocation := range q.users {
+		if !revocation.ExpiresAt.After(time.Now()) {
+			delete(q.users, username)
+		}
+	}
+	return nil
+}
+
+func newTestPayload(t *testing.T, username string, duration time.Duration) *token.Payload {
+	payload, err := token.NewPayload(username, "user", duration)
+	require.NoError(t, err)
+	return payload
+}
+
+func TestRevokeToken(t *testing.T) {
+	store := NewStore(newMemoryQuerier())
+	payload := newTestPayload(t, utils.RandomString(8), time.Minute)
+	other := newTestPayload(t, payload.Username, time.Minute)
+
+	require.False(t, store.IsRevoked(payload))
+	require.NoError(t, store.RevokeToken(context.Background(), payload))
+	require.True(t, store.IsRevoked(payload))
+	require.False(t, store.IsRevoked(other))
+}
+
+func TestRevokeSession(t *testing.T) {
+	store := NewStore(newMemoryQuerier())
+	session := db.Session{
+		ID:        uuid.New(),
+		Username:  utils.RandomString(8),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	payload := newTestPayload(t, session.Username, time.Minute)
+	payload.SessionID = &session.ID
+	otherSession := newTestPayload(t, session.Username, time.Minute)
+
+	require.False(t, store.IsRevoked(payload))
+	require.NoError(t, store.RevokeSession(context.Background(), session))
+	require.True(t, store.IsRevoked(payload))
+	require.True(t, store.IsTokenRevoked(session.ID))
+	require.False(t, store.IsRevoked(otherSession))
+}
+
+func TestRevokeUser(t *testing.T) {
+	store := NewStore(newMemoryQuerier())
+	username := utils.RandomString(8)
+	before := newTestPayload(t, username, time.Minute)
+	before.IssuedAt = before.IssuedAt.Add(-time.Second)
+	otherUser := newTestPayload(t, utils.RandomString(8), time.Minute)
+	otherUser.IssuedAt = before.IssuedAt
+	// a client may be named like the user
+	service := newTestPayload(t, username, time.Minute)
+	service.IssuedAt = before.IssuedAt
+	service.SubjectType = token.SubjectTypeService
+
+	require.NoError(t, store.RevokeUser(context.Background(), username, time.Minute))
+	require.True(t, store.IsRevoked(before))
+	require.False(t, store.IsRevoked(otherUser))
+	require.False(t, store.IsRevoked(service))
+
+	// issue times are whole seconds, tokens of the second of the revocation stay valid
+	after := newTestPayload(t, username, time.Minute)
+	require.False(t, store.IsRevoked(after))
+}
+
+func TestSync(t *testing.T) {
+	querier := newMemoryQuerier()
+	store := NewStore(querier)
+	expired := newTestPayload(t, utils.RandomString(8), -time.Minute)
+	active := newTestPayload(t, utils.RandomString(8), time.Minute)
+	require.NoError(t, store.RevokeToken(context.Background(), expired))
+	require.NoError(t, store.RevokeUser(context.Background(), expired.Username, -time.Minute))
+
+	// a revocation written by another replica
+	require.NoError(t, NewStore(querier).RevokeToken(context.Background(), active))
+	require.False(t, store.IsRevoked(active))
+
+	require.NoError(t, store.Sync(context.Background()))
+	require.True(t, store.IsRevoked(active))
+	require.NotContains(t, querier.tokens, expired.ID)
+	require.NotContains(t, querier.users, expired.Username)
+	require.NotContains(t, store.tokens, expired.ID)
+}
@@ -0,0 +1,159 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minRSAKeyBits = 2048
+
+// asymmetricKey is an entry of the AsymmetricJWTMaker key ring.
+// privateKey is only set for the active key.
+type asymmetricKey struct {
+	jwk        JSONWebKey
+	publicKey  crypto.PublicKey
+	privateKey crypto.Signer
+}
+
+// AsymmetricJWTMaker is a JSON web token maker signing with a private key.
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA, so downstream services
+// can verify tokens with the public keys published in the JWKS.
+type AsymmetricJWTMaker struct {
+	registeredClaims
+	keys KeyRing[asymmetricKey]
+}
+
+// NewAsymmetricJWTMaker creates a new AsymmetricJWTMaker from a PEM encoded private key
+func NewAsymmetricJWTMaker(privateKeyPEM []byte, options ...Option) (Maker, error) {
+	maker := &AsymmetricJWTMaker{registeredClaims: newRegisteredClaims(options)}
+	if err := maker.RotateKeys(privateKeyPEM); err != nil {
+		return nil, err
+	}
+	return maker, nil
+}
+
+// RotateKeys makes privateKeyPEM the signing key while the PEM encoded
+// verificationKeys, public or private, stay accepted and published
+func (maker *AsymmetricJWTMaker) RotateKeys(privateKeyPEM []byte, verificationKeys ...[]byte) error {
+	privateKey, err := ParsePrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return err
+	}
+	if key, ok := privateKey.(*rsa.PrivateKey); ok && key.N.BitLen() < minRSAKeyBits {
+		return fmt.Errorf("invalid key size: RSA keys must be at least %d bits", minRSAKeyBits)
+	}
+	activeJWK, err := NewJSONWebKey(privateKey.Public())
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]asymmetricKey{
+		activeJWK.Kid: {jwk: activeJWK, publicKey: privateKey.Public(), privateKey: privateKey},
+	}
+	for _, keyPEM := range verificationKeys {
+		publicKey, err := ParsePublicKeyPEM(keyPEM)
+		if err != nil {
+			return err
+		}
+		jwk, err := NewJSONWebKey(publicKey)
+		if err != nil {
+			return err
+		}
+		if _, ok := keys[jwk.Kid]; !ok {
+			keys[jwk.Kid] = asymmetricKey{jwk: jwk, publicKey: publicKey}
+		}
+	}
+	maker.keys.Set(activeJWK.Kid, keys)
+	return nil
+}
+
+// ActiveKeyID returns the kid of the key currently used for signing
+func (maker *AsymmetricJWTMaker) ActiveKeyID() string {
+	kid, _ := maker.keys.Active()
+	return kid
+}
+
+// CreateToken creates a new token for a specific username, role and duration
+func (maker *AsymmetricJWTMaker) CreateToken(username string, role string, duration time.Duration, options ...PayloadOption) (string, *Payload, error) {
+	payload, err := maker.newPayload(username, role, duration, options)
+	if err != nil {
+		return "", payload, err
+	}
+	token, err := maker.SignClaims(newJWTClaims(payload))
+	return token, payload, err
+}
+
+// SignClaims signs claims with the active key, naming it in the kid header
+func (maker *AsymmetricJWTMaker) SignClaims(claims jwt.Claims) (string, error) {
+	kid, key := maker.keys.Active()
+	jwtToken := jwt.NewWithClaims(jwt.GetSigningMethod(key.jwk.Alg), claims)
+	jwtToken.Header["kid"] = kid
+	return jwtToken.SignedString(key.privateKey)
+}
+
+// SigningAlgorithm returns the JWS algorithm of the active key
+func (maker *AsymmetricJWTMaker) SigningAlgorithm() string {
+	_, key := maker.keys.Active()
+	return key.jwk.Alg
+}
+
+// VerifyToken checks if the token is valid or not
+func (maker *AsymmetricJWTMaker) VerifyToken(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validate)
+}
+
+// VerifyTokenForAnyAudience checks if the token is valid, whatever its audience
+func (maker *AsymmetricJWTMaker) VerifyTokenForAnyAudience(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validateIssuer)
+}
+
+func (maker *AsymmetricJWTMaker) verifyToken(token string, validate func(*Payload) error) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keys.Get(kid)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		// only the algorithm of the selected key is accepted, so an HS256
+		// token signed with a public key can never be mistaken for a valid one
+		if token.Method.Alg() != key.jwk.Alg {
+			return nil, ErrInvalidToken
+		}
+		return key.publicKey, nil
+	}
+	jwtToken, err := jwt.ParseWithClaims(token, &jwtClaims{}, keyFunc)
+	if err != nil {
+		verr, ok := err.(*jwt.ValidationError)
+		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := jwtToken.Claims.(*jwtClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	payload, err := claims.payload()
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// JWKS returns the public keys accepted by the maker
+func (maker *AsymmetricJWTMaker) JWKS() JSONWebKeySet {
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range maker.keys.All() {
+		jwks.Keys = append(jwks.Keys, key.jwk)
+	}
+	return jwks
+}
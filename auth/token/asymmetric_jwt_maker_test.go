@@ -0,0 +1,158 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func newTestPrivateKeyPEM(t *testing.T, key any) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func newTestAsymmetricJWTMakers(t *testing.T) map[string]Maker {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaMaker, err := NewAsymmetricJWTMaker(newTestPrivateKeyPEM(t, rsaKey))
+	require.NoError(t, err)
+	ed25519Maker, err := NewAsymmetricJWTMaker(newTestPrivateKeyPEM(t, ed25519Key))
+	require.NoError(t, err)
+
+	return map[string]Maker{
+		"RS256": rsaMaker,
+		"EdDSA": ed25519Maker,
+	}
+}
+
+func TestAsymmetricJWTMaker(t *testing.T) {
+	for name, maker := range newTestAsymmetricJWTMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			username := utils.RandomString(12)
+			role := "admin"
+			duration := time.Minute
+
+			issuedAt := time.Now()
+			expiredAt := issuedAt.Add(duration)
+
+			token, payload, err := maker.CreateToken(username, role, duration)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.NotEmpty(t, payload)
+
+			require.NotZero(t, payload.ID)
+			require.Equal(t, username, payload.Username)
+			require.Equal(t, role, payload.Role)
+			require.Equal(t, PermissionsForRole(role), payload.Permissions)
+			require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+			require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+
+			claims := jwt.MapClaims{}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+			require.NoError(t, err)
+			require.Equal(t, name, parsed.Header["alg"])
+			require.Equal(t, username, claims["sub"])
+			require.True(t, claims.VerifyExpiresAt(time.Now().Unix(), true))
+
+			jwks := maker.(KeySetProvider).JWKS()
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, name, jwks.Keys[0].Alg)
+			require.Equal(t, jwks.Keys[0].Kid, parsed.Header["kid"])
+		})
+	}
+}
+
+func TestExpiredAsymmetricJWTToken(t *testing.T) {
+	for name, maker := range newTestAsymmetricJWTMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			token, payload, err := maker.CreateToken(utils.RandomString(12), "user", -time.Minute)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token)
+			require.Error(t, err)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidAsymmetricJWTTokenAlgHS256(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	maker, err := NewAsymmetricJWTMaker(newTestPrivateKeyPEM(t, rsaKey))
+	require.NoError(t, err)
+
+	payload, err := NewPayload(utils.RandomString(12), "user", time.Minute)
+	require.NoError(t, err)
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	token, err := jwtToken.SignedString(publicKeyPEM)
+	require.NoError(t, err)
+
+	payload, err = maker.VerifyToken(token)
+	require.Error(t, err)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestInvalidAsymmetricKeys(t *testing.T) {
+	_, err := NewAsymmetricJWTMaker([]byte("not a pem"))
+	require.Error(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewAsymmetricJWTMaker(newTestPrivateKeyPEM(t, rsaKey))
+	require.Error(t, err)
+}
+
+func TestAsymmetricJWTMakerSignClaims(t *testing.T) {
+	for name, maker := range newTestAsymmetricJWTMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			signer := maker.(ClaimsSigner)
+			require.Equal(t, name, signer.SigningAlgorithm())
+
+			claims := jwt.RegisteredClaims{
+				Subject:   utils.RandomString(12),
+				Audience:  jwt.ClaimStrings{"client"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			}
+			signed, err := signer.SignClaims(claims)
+			require.NoError(t, err)
+
+			// the claims verify with the published key of the maker
+			jwks := maker.(KeySetProvider).JWKS()
+			parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
+				require.Equal(t, jwks.Keys[0].Kid, token.Header["kid"])
+				return jwks.Keys[0].PublicKey()
+			})
+			require.NoError(t, err)
+			require.Equal(t, claims.Subject, parsed.Claims.(*jwt.RegisteredClaims).Subject)
+
+			// but are not accepted as an access token
+			_, err = maker.VerifyToken(signed)
+			require.Error(t, err)
+		})
+	}
+}
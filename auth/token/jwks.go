@@ -0,0 +1,191 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key type: only RSA and Ed25519 keys are allowed")
+
+// JSONWebKey is the public part of a signing key as described by RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySetProvider is implemented by makers whose tokens can be verified with public keys
+type KeySetProvider interface {
+	// JWKS returns the public keys accepted by the maker
+	JWKS() JSONWebKeySet
+}
+
+// ClaimsSigner is implemented by makers that can sign other JWTs, like
+// OpenID Connect ID tokens, with the keys they publish
+type ClaimsSigner interface {
+	// SignClaims signs claims with the active key
+	SignClaims(claims jwt.Claims) (string, error)
+
+	// SigningAlgorithm returns the JWS algorithm of the active key
+	SigningAlgorithm() string
+}
+
+// NewJSONWebKey builds the JWK for an RSA or Ed25519 public key.
+// The key ID is the RFC 7638 thumbprint of the key.
+func NewJSONWebKey(publicKey crypto.PublicKey) (JSONWebKey, error) {
+	var jwk JSONWebKey
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "RSA",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "OKP",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	default:
+		return jwk, ErrUnsupportedKey
+	}
+	jwk.Use = "sig"
+	jwk.Kid = jwk.thumbprint()
+	return jwk, nil
+}
+
+// PublicKey decodes the RSA or Ed25519 public key of the JWK
+func (jwk JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > math.MaxInt32 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// thumbprint computes the RFC 7638 thumbprint over the required members of the key
+func (jwk JSONWebKey) thumbprint() string {
+	var members []byte
+	if jwk.Kty == "RSA" {
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	} else {
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParsePrivateKeyPEM parses a PKCS#8 or PKCS#1 encoded RSA or Ed25519 private key
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// ParsePublicKeyPEM parses a PKIX encoded RSA or Ed25519 public key.
+// A private key is accepted as well, in which case its public part is returned.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		privateKey, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.Public(), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key: %w", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return key, nil
+	case ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
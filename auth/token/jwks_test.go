@@ -0,0 +1,30 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONWebKeyPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, publicKey := range []any{&rsaKey.PublicKey, ed25519Key} {
+		jwk, err := NewJSONWebKey(publicKey)
+		require.NoError(t, err)
+		decoded, err := jwk.PublicKey()
+		require.NoError(t, err)
+		require.Equal(t, publicKey, decoded)
+	}
+
+	_, err = JSONWebKey{Kty: "EC", Crv: "P-256"}.PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+	_, err = JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: "c2hvcnQ"}.PublicKey()
+	require.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// jwtClaims is the payload as the JWT makers encode it, with the registered
+// claims of RFC 7519 section 4.1 under their registered names so that any
+// JWT library verifying against the JWKS reads them
+type jwtClaims struct {
+	ID          string           `json:"jti"`
+	Subject     string           `json:"sub"`
+	SubjectType string           `json:"sub_type,omitempty"`
+	Actor       *Actor           `json:"act,omitempty"`
+	MFAPending  bool             `json:"mfa_pending,omitempty"`
+	ClientID    string           `json:"client_id,omitempty"`
+	SessionID   *uuid.UUID       `json:"session_id,omitempty"`
+	Purpose     string           `json:"purpose,omitempty"`
+	Role        string           `json:"role"`
+	Permissions []string         `json:"permissions"`
+	Issuer      string           `json:"iss,omitempty"`
+	Audience    string           `json:"aud,omitempty"`
+	IssuedAt    *jwt.NumericDate `json:"iat"`
+	NotBefore   *jwt.NumericDate `json:"nbf"`
+	ExpiresAt   *jwt.NumericDate `json:"exp"`
+}
+
+func newJWTClaims(payload *Payload) *jwtClaims {
+	return &jwtClaims{
+		ID:          payload.ID.String(),
+		Subject:     payload.Username,
+		SubjectType: payload.SubjectType,
+		Actor:       payload.Actor,
+		MFAPending:  payload.MFAPending,
+		ClientID:    payload.ClientID,
+		SessionID:   payload.SessionID,
+		Purpose:     payload.Purpose,
+		Role:        payload.Role,
+		Permissions: payload.Permissions,
+		Issuer:      payload.Issuer,
+		Audience:    payload.Audience,
+		IssuedAt:    jwt.NewNumericDate(payload.IssuedAt),
+		NotBefore:   jwt.NewNumericDate(payload.IssuedAt),
+		ExpiresAt:   jwt.NewNumericDate(payload.ExpiredAt),
+	}
+}
+
+// Valid checks the time claims, the expiry is required
+func (claims *jwtClaims) Valid() error {
+	now := time.Now()
+	if claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Time) {
+		return ErrExpiredToken
+	}
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Time) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// payload turns verified claims back into a Payload
+func (claims *jwtClaims) payload() (*Payload, error) {
+	id, err := uuid.Parse(claims.ID)
+	if err != nil || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+	return &Payload{
+		ID:          id,
+		Username:    claims.Subject,
+		SubjectType: claims.SubjectType,
+		Actor:       claims.Actor,
+		MFAPending:  claims.MFAPending,
+		ClientID:    claims.ClientID,
+		SessionID:   claims.SessionID,
+		Purpose:     claims.Purpose,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		Issuer:      claims.Issuer,
+		Audience:    claims.Audience,
+		IssuedAt:    claims.IssuedAt.Time,
+		ExpiredAt:   claims.ExpiresAt.Time,
+	}, nil
+}
@@ -5,44 +5,82 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
 )
 
 const minSecretKeySize = 32
 
 // JWTMaker is a JSON web token maker
 type JWTMaker struct {
-	secretKey string
+	registeredClaims
+	keys KeyRing[[]byte]
 }
 
 // NewJWTMaker creates a new JWTMaker
-func NewJWTMaker(secretKey string) (Maker, error) {
-	if len(secretKey) < minSecretKeySize {
-		return nil, fmt.Errorf("invalid key size: must be of %d characters", minSecretKeySize)
+func NewJWTMaker(secretKey string, options ...Option) (Maker, error) {
+	maker := &JWTMaker{registeredClaims: newRegisteredClaims(options)}
+	if err := maker.RotateKeys([]byte(secretKey)); err != nil {
+		return nil, err
 	}
-	return &JWTMaker{secretKey: secretKey}, nil
+	return maker, nil
 }
 
-// CreateToken creates a new token for a specific username and duration
-func (maker *JWTMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+// RotateKeys makes secretKey the signing key while verificationKeys stay accepted
+func (maker *JWTMaker) RotateKeys(secretKey []byte, verificationKeys ...[]byte) error {
+	keys := make(map[string][]byte)
+	for _, key := range append([][]byte{secretKey}, verificationKeys...) {
+		if len(key) < minSecretKeySize {
+			return fmt.Errorf("invalid key size: must be of %d characters", minSecretKeySize)
+		}
+		keys[symmetricKeyID(key)] = key
+	}
+	maker.keys.Set(symmetricKeyID(secretKey), keys)
+	return nil
+}
+
+// ActiveKeyID returns the kid of the key currently used for signing
+func (maker *JWTMaker) ActiveKeyID() string {
+	kid, _ := maker.keys.Active()
+	return kid
+}
+
+// CreateToken creates a new token for a specific username, role and duration
+func (maker *JWTMaker) CreateToken(username string, role string, duration time.Duration, options ...PayloadOption) (string, *Payload, error) {
+	payload, err := maker.newPayload(username, role, duration, options)
 	if err != nil {
-		return "", err
+		return "", payload, err
 	}
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	return jwtToken.SignedString([]byte(maker.secretKey))
+	kid, secretKey := maker.keys.Active()
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newJWTClaims(payload))
+	jwtToken.Header["kid"] = kid
+	token, err := jwtToken.SignedString(secretKey)
+	return token, payload, err
 }
 
 // VerifyToken checks if the token is valid or not
 func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validate)
+}
+
+// VerifyTokenForAnyAudience checks if the token is valid, whatever its audience
+func (maker *JWTMaker) VerifyTokenForAnyAudience(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validateIssuer)
+}
+
+func (maker *JWTMaker) verifyToken(token string, validate func(*Payload) error) (*Payload, error) {
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
 		_, ok := token.Method.(*jwt.SigningMethodHMAC)
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(maker.secretKey), nil
+		kid, _ := token.Header["kid"].(string)
+		secretKey, ok := maker.keys.Get(kid)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return secretKey, nil
 	}
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	jwtToken, err := jwt.ParseWithClaims(token, &jwtClaims{}, keyFunc)
 	if err != nil {
 		verr, ok := err.(*jwt.ValidationError)
 		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
@@ -51,9 +89,16 @@ func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 		return nil, ErrInvalidToken
 	}
 
-	payload, ok := jwtToken.Claims.(*Payload)
+	claims, ok := jwtToken.Claims.(*jwtClaims)
 	if !ok {
 		return nil, ErrInvalidToken
 	}
+	payload, err := claims.payload()
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(payload); err != nil {
+		return nil, err
+	}
 	return payload, nil
 }
@@ -4,7 +4,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/require"
 	"shivesh-ranjan.github.io/m/utils"
 )
@@ -14,23 +14,38 @@ func TestJWTMaker(t *testing.T) {
 	require.NoError(t, err)
 
 	username := utils.RandomString(12)
+	role := "user"
 	duration := time.Minute
 
 	issuedAt := time.Now()
 	expiredAt := issuedAt.Add(duration)
 
-	token, err := maker.CreateToken(username, duration)
+	token, payload, err := maker.CreateToken(username, role, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token)
 	require.NoError(t, err)
 	require.NotEmpty(t, payload)
 
 	require.NotZero(t, payload.ID)
 	require.Equal(t, username, payload.Username)
+	require.Equal(t, role, payload.Role)
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
 	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+
+	// other JWT libraries find the registered claims under their own names
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	require.Equal(t, payload.ID.String(), claims["jti"])
+	require.Equal(t, username, claims["sub"])
+	now := time.Now().Unix()
+	require.True(t, claims.VerifyIssuedAt(now, true))
+	require.True(t, claims.VerifyNotBefore(now, true))
+	require.True(t, claims.VerifyExpiresAt(now, true))
+	require.NotContains(t, claims, "username")
 }
 
 func TestExpiredJWTToken(t *testing.T) {
@@ -39,18 +54,19 @@ func TestExpiredJWTToken(t *testing.T) {
 
 	username := utils.RandomString(12)
 
-	token, err := maker.CreateToken(username, -time.Minute)
+	token, payload, err := maker.CreateToken(username, "user", -time.Minute)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token)
 	require.Error(t, err)
 	require.EqualError(t, err, ErrExpiredToken.Error())
 	require.Nil(t, payload)
 }
 
 func TestInvalidJWTTokenAlgNone(t *testing.T) {
-	payload, err := NewPayload(utils.RandomString(12), time.Minute)
+	payload, err := NewPayload(utils.RandomString(12), "user", time.Minute)
 	require.NoError(t, err)
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
@@ -0,0 +1,72 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// KeyRotator is implemented by makers whose signing keys can be rotated at runtime
+type KeyRotator interface {
+	// RotateKeys makes activeKey the signing key while verificationKeys stay
+	// accepted for tokens that were signed before the rotation
+	RotateKeys(activeKey []byte, verificationKeys ...[]byte) error
+
+	// ActiveKeyID returns the kid of the key currently used for signing
+	ActiveKeyID() string
+}
+
+// KeyRing holds the keys of a maker indexed by their kid.
+// The active key signs new tokens, every key in the ring verifies them.
+type KeyRing[K any] struct {
+	mu        sync.RWMutex
+	activeKid string
+	keys      map[string]K
+}
+
+// Set atomically replaces all the keys of the ring
+func (ring *KeyRing[K]) Set(activeKid string, keys map[string]K) {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	ring.activeKid = activeKid
+	ring.keys = keys
+}
+
+// Active returns the signing key and its kid
+func (ring *KeyRing[K]) Active() (string, K) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	return ring.activeKid, ring.keys[ring.activeKid]
+}
+
+// Get looks up a verification key by kid.
+// Tokens issued before kid headers existed fall back to the active key.
+func (ring *KeyRing[K]) Get(kid string) (K, bool) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	if kid == "" {
+		kid = ring.activeKid
+	}
+	key, ok := ring.keys[kid]
+	return key, ok
+}
+
+// All returns every key of the ring, the active one first
+func (ring *KeyRing[K]) All() []K {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	keys := []K{ring.keys[ring.activeKid]}
+	for kid, key := range ring.keys {
+		if kid != ring.activeKid {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// symmetricKeyID derives a stable kid from a shared secret, so every replica
+// loading the same key agrees on its kid without exposing the key itself
+func symmetricKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
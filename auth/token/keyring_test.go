@@ -0,0 +1,95 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestKeyRotation(t *testing.T) {
+	testcases := []struct {
+		name     string
+		newKey   func(t *testing.T) []byte
+		newMaker func(key []byte) (Maker, error)
+	}{
+		{
+			name:   "JWT",
+			newKey: func(t *testing.T) []byte { return []byte(utils.RandomString(32)) },
+			newMaker: func(key []byte) (Maker, error) {
+				return NewJWTMaker(string(key))
+			},
+		},
+		{
+			name: "AsymmetricJWT",
+			newKey: func(t *testing.T) []byte {
+				_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				return newTestPrivateKeyPEM(t, privateKey)
+			},
+			newMaker: func(key []byte) (Maker, error) {
+				return NewAsymmetricJWTMaker(key)
+			},
+		},
+		{
+			name:   "PasetoLocal",
+			newKey: func(t *testing.T) []byte { return []byte(utils.RandomString(32)) },
+			newMaker: func(key []byte) (Maker, error) {
+				return NewPasetoLocalMaker(string(key))
+			},
+		},
+		{
+			name: "PasetoPublic",
+			newKey: func(t *testing.T) []byte {
+				return []byte(paseto.NewV4AsymmetricSecretKey().ExportSeedHex())
+			},
+			newMaker: func(key []byte) (Maker, error) {
+				return NewPasetoPublicMaker(string(key))
+			},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			oldKey, newKey := tc.newKey(t), tc.newKey(t)
+
+			maker, err := tc.newMaker(oldKey)
+			require.NoError(t, err)
+			rotator, ok := maker.(KeyRotator)
+			require.True(t, ok)
+			oldKid := rotator.ActiveKeyID()
+			require.NotEmpty(t, oldKid)
+
+			oldToken, _, err := maker.CreateToken(utils.RandomString(12), "user", time.Minute)
+			require.NoError(t, err)
+
+			// the new key signs while the old one is still accepted
+			err = rotator.RotateKeys(newKey, oldKey)
+			require.NoError(t, err)
+			require.NotEqual(t, oldKid, rotator.ActiveKeyID())
+
+			newToken, _, err := maker.CreateToken(utils.RandomString(12), "user", time.Minute)
+			require.NoError(t, err)
+
+			_, err = maker.VerifyToken(oldToken)
+			require.NoError(t, err)
+			_, err = maker.VerifyToken(newToken)
+			require.NoError(t, err)
+
+			// once the old key is retired its tokens are rejected
+			err = rotator.RotateKeys(newKey)
+			require.NoError(t, err)
+
+			_, err = maker.VerifyToken(oldToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			_, err = maker.VerifyToken(newToken)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -4,9 +4,78 @@ import "time"
 
 // Maker is an interface for managing tokens
 type Maker interface {
-	// CreateToken creates a new token for a specific username and duration
-	CreateToken(username string, duration time.Duration) (string, error)
+	// CreateToken creates a new token for a specific username, role and duration
+	CreateToken(username string, role string, duration time.Duration, options ...PayloadOption) (string, *Payload, error)
 
 	// VerifyToken checks if the token is valid or not
-	VerifyToken(username string) (*Payload, error)
+	VerifyToken(token string) (*Payload, error)
+
+	// VerifyTokenForAnyAudience checks the token like VerifyToken but also
+	// accepts tokens issued for other services, for introspection
+	VerifyTokenForAnyAudience(token string) (*Payload, error)
+}
+
+// Option configures the registered claims of a Maker
+type Option func(*registeredClaims)
+
+// WithIssuer stamps new tokens with issuer and only accepts tokens from it
+func WithIssuer(issuer string) Option {
+	return func(claims *registeredClaims) {
+		claims.issuer = issuer
+	}
+}
+
+// WithAudience makes audience the default audience of new tokens and the only one accepted
+func WithAudience(audience string) Option {
+	return func(claims *registeredClaims) {
+		claims.audience = audience
+	}
+}
+
+// registeredClaims holds the issuer and audience a Maker issues and accepts.
+// Empty values are neither stamped nor checked.
+type registeredClaims struct {
+	issuer   string
+	audience string
+}
+
+func newRegisteredClaims(options []Option) registeredClaims {
+	var claims registeredClaims
+	for _, option := range options {
+		option(&claims)
+	}
+	return claims
+}
+
+// newPayload creates a payload carrying the registered claims, then applies the payload options
+func (claims registeredClaims) newPayload(username string, role string, duration time.Duration, options []PayloadOption) (*Payload, error) {
+	payload, err := NewPayload(username, role, duration)
+	if err != nil {
+		return nil, err
+	}
+	payload.Issuer = claims.issuer
+	payload.Audience = claims.audience
+	for _, option := range options {
+		option(payload)
+	}
+	return payload, nil
+}
+
+// validate checks that the payload was issued by and for us
+func (claims registeredClaims) validate(payload *Payload) error {
+	if err := claims.validateIssuer(payload); err != nil {
+		return err
+	}
+	if claims.audience != "" && payload.Audience != claims.audience {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// validateIssuer checks that the payload was issued by us, for any audience
+func (claims registeredClaims) validateIssuer(payload *Payload) error {
+	if claims.issuer != "" && payload.Issuer != claims.issuer {
+		return ErrInvalidToken
+	}
+	return nil
 }
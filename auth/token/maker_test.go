@@ -0,0 +1,64 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestIssuerAndAudience(t *testing.T) {
+	testcases := []struct {
+		name     string
+		newMaker func(key string, options ...Option) (Maker, error)
+	}{
+		{name: "JWT", newMaker: NewJWTMaker},
+		{name: "PasetoLocal", newMaker: NewPasetoLocalMaker},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			key := utils.RandomString(32)
+			gateway, err := tc.newMaker(key, WithIssuer("auth"), WithAudience("gateway"))
+			require.NoError(t, err)
+			blog, err := tc.newMaker(key, WithIssuer("auth"), WithAudience("blog"))
+			require.NoError(t, err)
+			otherIssuer, err := tc.newMaker(key, WithIssuer("other"), WithAudience("gateway"))
+			require.NoError(t, err)
+
+			gatewayToken, payload, err := gateway.CreateToken(utils.RandomString(12), "admin", time.Minute)
+			require.NoError(t, err)
+			require.Equal(t, "auth", payload.Issuer)
+			require.Equal(t, "gateway", payload.Audience)
+
+			payload, err = gateway.VerifyToken(gatewayToken)
+			require.NoError(t, err)
+			require.Equal(t, "gateway", payload.Audience)
+
+			_, err = blog.VerifyToken(gatewayToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			_, err = otherIssuer.VerifyToken(gatewayToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+
+			blogToken, payload, err := gateway.CreateToken(utils.RandomString(12), "admin", time.Minute, ForAudience("blog"), WithPermissions(nil))
+			require.NoError(t, err)
+			require.Empty(t, payload.Permissions)
+
+			_, err = gateway.VerifyToken(blogToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			payload, err = blog.VerifyToken(blogToken)
+			require.NoError(t, err)
+			require.Equal(t, "blog", payload.Audience)
+
+			// introspection accepts every audience but still only our issuer
+			payload, err = gateway.VerifyTokenForAnyAudience(blogToken)
+			require.NoError(t, err)
+			require.Equal(t, "blog", payload.Audience)
+			_, err = otherIssuer.VerifyTokenForAnyAudience(blogToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+		})
+	}
+}
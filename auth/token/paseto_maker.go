@@ -0,0 +1,171 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+)
+
+// pasetoKey is an entry of the PasetoMaker key ring.
+// Only the fields matching the purpose of the maker are set.
+type pasetoKey struct {
+	symmetricKey paseto.V4SymmetricKey
+	secretKey    paseto.V4AsymmetricSecretKey
+	publicKey    paseto.V4AsymmetricPublicKey
+}
+
+// pasetoFooter is the unencrypted but authenticated footer of our tokens
+type pasetoFooter struct {
+	Kid string `json:"kid"`
+}
+
+// PasetoMaker is a PASETO v4 token maker.
+// In local mode tokens are encrypted with a symmetric key, in public mode
+// they are signed with an Ed25519 secret key.
+type PasetoMaker struct {
+	registeredClaims
+	purpose paseto.Purpose
+	keys    KeyRing[pasetoKey]
+}
+
+// NewPasetoLocalMaker creates a new PasetoMaker issuing v4.local tokens
+func NewPasetoLocalMaker(symmetricKey string, options ...Option) (Maker, error) {
+	maker := &PasetoMaker{registeredClaims: newRegisteredClaims(options), purpose: paseto.Local}
+	if err := maker.RotateKeys([]byte(symmetricKey)); err != nil {
+		return nil, err
+	}
+	return maker, nil
+}
+
+// NewPasetoPublicMaker creates a new PasetoMaker issuing v4.public tokens.
+// The secret key is the hex encoded 32 byte Ed25519 seed.
+func NewPasetoPublicMaker(secretKeySeed string, options ...Option) (Maker, error) {
+	maker := &PasetoMaker{registeredClaims: newRegisteredClaims(options), purpose: paseto.Public}
+	if err := maker.RotateKeys([]byte(secretKeySeed)); err != nil {
+		return nil, err
+	}
+	return maker, nil
+}
+
+// RotateKeys makes activeKey the signing key while verificationKeys stay accepted.
+// Keys are raw 32 character secrets in local mode and hex encoded seeds in public mode.
+func (maker *PasetoMaker) RotateKeys(activeKey []byte, verificationKeys ...[]byte) error {
+	keys := make(map[string]pasetoKey)
+	var activeKid string
+	for i, rawKey := range append([][]byte{activeKey}, verificationKeys...) {
+		kid, key, err := maker.parseKey(rawKey)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			activeKid = kid
+		}
+		keys[kid] = key
+	}
+	maker.keys.Set(activeKid, keys)
+	return nil
+}
+
+func (maker *PasetoMaker) parseKey(rawKey []byte) (string, pasetoKey, error) {
+	if maker.purpose == paseto.Public {
+		secretKey, err := paseto.NewV4AsymmetricSecretKeyFromSeed(string(rawKey))
+		if err != nil {
+			return "", pasetoKey{}, fmt.Errorf("invalid asymmetric key: %w", err)
+		}
+		publicKey := secretKey.Public()
+		return symmetricKeyID(publicKey.ExportBytes()), pasetoKey{secretKey: secretKey, publicKey: publicKey}, nil
+	}
+
+	symmetricKey, err := paseto.V4SymmetricKeyFromBytes(rawKey)
+	if err != nil {
+		return "", pasetoKey{}, fmt.Errorf("invalid key size: must be exactly %d characters", minSecretKeySize)
+	}
+	return symmetricKeyID(rawKey), pasetoKey{symmetricKey: symmetricKey}, nil
+}
+
+// ActiveKeyID returns the kid of the key currently used for signing
+func (maker *PasetoMaker) ActiveKeyID() string {
+	kid, _ := maker.keys.Active()
+	return kid
+}
+
+// CreateToken creates a new token for a specific username, role and duration
+func (maker *PasetoMaker) CreateToken(username string, role string, duration time.Duration, options ...PayloadOption) (string, *Payload, error) {
+	payload, err := maker.newPayload(username, role, duration, options)
+	if err != nil {
+		return "", payload, err
+	}
+	claims, err := json.Marshal(payload)
+	if err != nil {
+		return "", payload, err
+	}
+	kid, key := maker.keys.Active()
+	footer, err := json.Marshal(pasetoFooter{Kid: kid})
+	if err != nil {
+		return "", payload, err
+	}
+	pasetoToken, err := paseto.NewTokenFromClaimsJSON(claims, footer)
+	if err != nil {
+		return "", payload, err
+	}
+	if maker.purpose == paseto.Public {
+		return pasetoToken.V4Sign(key.secretKey, nil), payload, nil
+	}
+	return pasetoToken.V4Encrypt(key.symmetricKey, nil), payload, nil
+}
+
+// VerifyToken checks if the token is valid or not
+func (maker *PasetoMaker) VerifyToken(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validate)
+}
+
+// VerifyTokenForAnyAudience checks if the token is valid, whatever its audience
+func (maker *PasetoMaker) VerifyTokenForAnyAudience(token string) (*Payload, error) {
+	return maker.verifyToken(token, maker.validateIssuer)
+}
+
+func (maker *PasetoMaker) verifyToken(token string, validate func(*Payload) error) (*Payload, error) {
+	// expiry is checked by Payload.Valid so that callers get ErrExpiredToken
+	parser := paseto.NewParserWithoutExpiryCheck()
+
+	// the footer is only trusted to pick the key, parsing authenticates it
+	var footer pasetoFooter
+	protocol := paseto.V4Local
+	if maker.purpose == paseto.Public {
+		protocol = paseto.V4Public
+	}
+	if rawFooter, err := parser.UnsafeParseFooter(protocol, token); err == nil && len(rawFooter) > 0 {
+		if err := json.Unmarshal(rawFooter, &footer); err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	key, ok := maker.keys.Get(footer.Kid)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	var pasetoToken *paseto.Token
+	var err error
+	if maker.purpose == paseto.Public {
+		pasetoToken, err = parser.ParseV4Public(key.publicKey, token, nil)
+	} else {
+		pasetoToken, err = parser.ParseV4Local(key.symmetricKey, token, nil)
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{}
+	if err := json.Unmarshal(pasetoToken.ClaimsJSON(), payload); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := payload.Valid(); err != nil {
+		return nil, err
+	}
+	if err := validate(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
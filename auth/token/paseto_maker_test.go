@@ -0,0 +1,91 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func newTestPasetoMakers(t *testing.T) map[string]Maker {
+	localMaker, err := NewPasetoLocalMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	publicMaker, err := NewPasetoPublicMaker(paseto.NewV4AsymmetricSecretKey().ExportSeedHex())
+	require.NoError(t, err)
+
+	return map[string]Maker{
+		"Local":  localMaker,
+		"Public": publicMaker,
+	}
+}
+
+func TestPasetoMaker(t *testing.T) {
+	for name, maker := range newTestPasetoMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			username := utils.RandomString(12)
+			role := "admin"
+			duration := time.Minute
+
+			issuedAt := time.Now()
+			expiredAt := issuedAt.Add(duration)
+
+			token, payload, err := maker.CreateToken(username, role, duration)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.NotEmpty(t, payload)
+
+			require.NotZero(t, payload.ID)
+			require.Equal(t, username, payload.Username)
+			require.Equal(t, role, payload.Role)
+			require.Equal(t, PermissionsForRole(role), payload.Permissions)
+			require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+			require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+		})
+	}
+}
+
+func TestExpiredPasetoToken(t *testing.T) {
+	for name, maker := range newTestPasetoMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			token, payload, err := maker.CreateToken(utils.RandomString(12), "user", -time.Minute)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token)
+			require.Error(t, err)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidPasetoTokenWrongKey(t *testing.T) {
+	for name, maker := range newTestPasetoMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			token, _, err := maker.CreateToken(utils.RandomString(12), "user", time.Minute)
+			require.NoError(t, err)
+
+			otherMaker := newTestPasetoMakers(t)[name]
+			payload, err := otherMaker.VerifyToken(token)
+			require.Error(t, err)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidPasetoKeys(t *testing.T) {
+	_, err := NewPasetoLocalMaker(utils.RandomString(31))
+	require.Error(t, err)
+
+	_, err = NewPasetoPublicMaker("not-hex")
+	require.Error(t, err)
+}
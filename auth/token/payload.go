@@ -12,33 +12,154 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
-// Payload contains the payload data of the token
+// Purposes of tokens that grant no access by themselves
+const (
+	// PurposeRefresh tokens only renew the access token of their session
+	PurposeRefresh = "refresh"
+)
+
+// Subject types tell human users apart from other services
+const (
+	SubjectTypeUser    = "user"
+	SubjectTypeService = "service"
+)
+
+// Actor is the party acting on behalf of the subject of a token, see RFC 8693
+type Actor struct {
+	Username string `json:"sub"`
+}
+
+// Payload contains the payload data of the token.
+// For service tokens Username is the client ID of the service.
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
+	ID          uuid.UUID  `json:"id"`
+	Username    string     `json:"username"`
+	SubjectType string     `json:"sub_type,omitempty"`
+	Actor       *Actor     `json:"act,omitempty"`
+	MFAPending  bool       `json:"mfa_pending,omitempty"`
+	ClientID    string     `json:"client_id,omitempty"`
+	SessionID   *uuid.UUID `json:"session_id,omitempty"`
+	Purpose     string     `json:"purpose,omitempty"`
+	Role        string     `json:"role"`
+	Permissions []string   `json:"permissions"`
+	Issuer      string     `json:"iss,omitempty"`
+	Audience    string     `json:"aud,omitempty"`
+	IssuedAt    time.Time  `json:"issued_at"`
+	ExpiredAt   time.Time  `json:"expired_at"`
+	// NeverExpires is set for credentials without an expiry, like some API
+	// keys, ExpiredAt is meaningless then
+	NeverExpires bool `json:"never_expires,omitempty"`
 }
 
-// NewPayload creates a new token payload with a specific username and duration
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+// NewPayload creates a new token payload with a specific username, role and duration
+func NewPayload(username string, role string, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
+	// JWTs carry times in whole seconds, every token type does the same so
+	// that they compare alike
+	now := time.Now().Truncate(time.Second)
 	payload := &Payload{
-		ID:        tokenID,
-		Username:  username,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+		ID:          tokenID,
+		Username:    username,
+		SubjectType: SubjectTypeUser,
+		Role:        role,
+		Permissions: PermissionsForRole(role),
+		IssuedAt:    now,
+		ExpiredAt:   now.Add(duration),
 	}
 	return payload, nil
 }
 
+// PayloadOption customizes the payload of a single token
+type PayloadOption func(*Payload)
+
+// ForPurpose issues a token that only serves purpose, like renewing the
+// access token of a session. It grants no access by itself.
+func ForPurpose(purpose string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Purpose = purpose
+	}
+}
+
+// ForAudience issues the token for another service than the default audience
+func ForAudience(audience string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Audience = audience
+	}
+}
+
+// WithPermissions replaces the permissions granted by the role
+func WithPermissions(permissions []string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Permissions = permissions
+	}
+}
+
+// WithSubjectType issues the token for another kind of principal than a user
+func WithSubjectType(subjectType string) PayloadOption {
+	return func(payload *Payload) {
+		payload.SubjectType = subjectType
+	}
+}
+
+// WithActor issues the token to username on behalf of the actor, when an
+// admin impersonates a user
+func WithActor(actor string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Actor = &Actor{Username: actor}
+	}
+}
+
+// WithMFAPending issues a token that only proves the password was checked.
+// It must be exchanged with a second factor before it grants any access.
+func WithMFAPending() PayloadOption {
+	return func(payload *Payload) {
+		payload.MFAPending = true
+	}
+}
+
+// ForClient issues the token to a third-party application the user signed
+// in to. Such tokens only grant the scopes the user consented to.
+func ForClient(clientID string) PayloadOption {
+	return func(payload *Payload) {
+		payload.ClientID = clientID
+	}
+}
+
+// ForSession ties an access token to the session it was issued for, so it
+// stops working when the session is revoked
+func ForSession(sessionID uuid.UUID) PayloadOption {
+	return func(payload *Payload) {
+		payload.SessionID = &sessionID
+	}
+}
+
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
-	if time.Now().After(payload.ExpiredAt) {
+	if !payload.NeverExpires && time.Now().After(payload.ExpiredAt) {
 		return ErrExpiredToken
 	}
 	return nil
 }
+
+// IsService reports whether the token was issued to a service rather than a user
+func (payload *Payload) IsService() bool {
+	return payload.SubjectType == SubjectTypeService
+}
+
+// IsImpersonated reports whether someone else acts as the subject of the token
+func (payload *Payload) IsImpersonated() bool {
+	return payload.Actor != nil
+}
+
+// HasPermission checks if the token grants a specific permission
+func (payload *Payload) HasPermission(permission string) bool {
+	for _, granted := range payload.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
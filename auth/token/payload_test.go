@@ -0,0 +1,119 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func TestPayloadPermissions(t *testing.T) {
+	admin, err := NewPayload(utils.RandomString(12), "admin", time.Minute)
+	require.NoError(t, err)
+	require.True(t, admin.HasPermission(PermissionManageRoles))
+	require.True(t, admin.HasPermission(PermissionManageUsers))
+
+	user, err := NewPayload(utils.RandomString(12), "user", time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, user.Permissions)
+	require.False(t, user.HasPermission(PermissionManageRoles))
+}
+
+func TestPayloadSubjectType(t *testing.T) {
+	user, err := NewPayload(utils.RandomString(12), "user", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, SubjectTypeUser, user.SubjectType)
+	require.False(t, user.IsService())
+
+	maker, err := NewPasetoLocalMaker(utils.RandomString(32))
+	require.NoError(t, err)
+	serviceToken, _, err := maker.CreateToken("notification", "", time.Minute, WithSubjectType(SubjectTypeService))
+	require.NoError(t, err)
+
+	service, err := maker.VerifyToken(serviceToken)
+	require.NoError(t, err)
+	require.True(t, service.IsService())
+}
+
+func TestPayloadNeverExpires(t *testing.T) {
+	payload, err := NewPayload(utils.RandomString(12), "user", -time.Minute)
+	require.NoError(t, err)
+	require.ErrorIs(t, payload.Valid(), ErrExpiredToken)
+
+	payload.NeverExpires = true
+	require.NoError(t, payload.Valid())
+}
+
+func TestPayloadActor(t *testing.T) {
+	maker, err := NewJWTMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	impersonationToken, _, err := maker.CreateToken("user", "user", time.Minute, WithActor("admin"))
+	require.NoError(t, err)
+	payload, err := maker.VerifyToken(impersonationToken)
+	require.NoError(t, err)
+	require.True(t, payload.IsImpersonated())
+	require.Equal(t, "admin", payload.Actor.Username)
+
+	userToken, _, err := maker.CreateToken("user", "user", time.Minute)
+	require.NoError(t, err)
+	payload, err = maker.VerifyToken(userToken)
+	require.NoError(t, err)
+	require.False(t, payload.IsImpersonated())
+}
+
+func TestPayloadMFAPending(t *testing.T) {
+	maker, err := NewJWTMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	mfaToken, _, err := maker.CreateToken("user", "user", time.Minute, WithMFAPending())
+	require.NoError(t, err)
+	payload, err := maker.VerifyToken(mfaToken)
+	require.NoError(t, err)
+	require.True(t, payload.MFAPending)
+
+	userToken, _, err := maker.CreateToken("user", "user", time.Minute)
+	require.NoError(t, err)
+	payload, err = maker.VerifyToken(userToken)
+	require.NoError(t, err)
+	require.False(t, payload.MFAPending)
+}
+
+func TestPayloadForClient(t *testing.T) {
+	maker, err := NewJWTMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	clientToken, _, err := maker.CreateToken("user", "user", time.Minute, ForClient("app"), WithPermissions([]string{"openid"}))
+	require.NoError(t, err)
+	payload, err := maker.VerifyToken(clientToken)
+	require.NoError(t, err)
+	require.Equal(t, "app", payload.ClientID)
+	require.True(t, payload.HasPermission("openid"))
+
+	userToken, _, err := maker.CreateToken("user", "user", time.Minute)
+	require.NoError(t, err)
+	payload, err = maker.VerifyToken(userToken)
+	require.NoError(t, err)
+	require.Empty(t, payload.ClientID)
+}
+
+func TestPayloadForSession(t *testing.T) {
+	maker, err := NewPasetoLocalMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	sessionID := uuid.New()
+	sessionToken, _, err := maker.CreateToken("user", "user", time.Minute, ForSession(sessionID))
+	require.NoError(t, err)
+	payload, err := maker.VerifyToken(sessionToken)
+	require.NoError(t, err)
+	require.NotNil(t, payload.SessionID)
+	require.Equal(t, sessionID, *payload.SessionID)
+
+	userToken, _, err := maker.CreateToken("user", "user", time.Minute)
+	require.NoError(t, err)
+	payload, err = maker.VerifyToken(userToken)
+	require.NoError(t, err)
+	require.Nil(t, payload.SessionID)
+}
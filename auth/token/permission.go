@@ -0,0 +1,45 @@
+package token
+
+// Permissions granted by the claims of a token
+const (
+	PermissionManageRoles      = "roles:manage"
+	PermissionManageUsers      = "users:manage"
+	PermissionManageKeys       = "keys:manage"
+	PermissionManageClients    = "clients:manage"
+	PermissionImpersonateUsers = "users:impersonate"
+)
+
+// Scopes an API key or a service client can be limited to on top of the
+// permissions of a role. Tokens issued at login are not restricted by them.
+const (
+	ScopeWriteBlog       = "blog:write"
+	ScopeWriteProfile    = "profile:write"
+	ScopeIntrospectToken = "tokens:introspect"
+)
+
+// Scopes a third-party application can ask users to consent to when they
+// sign in to it with OpenID Connect
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// rolePermissions maps a role to the permissions embedded in its tokens.
+// Roles without an entry, like "user", only act on their own account.
+var rolePermissions = map[string][]string{
+	"admin": {
+		PermissionManageRoles,
+		PermissionManageUsers,
+		PermissionManageKeys,
+		PermissionManageClients,
+		PermissionImpersonateUsers,
+	},
+}
+
+// PermissionsForRole returns the permission set of a role
+func PermissionsForRole(role string) []string {
+	permissions := make([]string, len(rolePermissions[role]))
+	copy(permissions, rolePermissions[role])
+	return permissions
+}
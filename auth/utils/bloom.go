@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// bloomFilterMagic starts every serialized BloomFilter
+var bloomFilterMagic = [4]byte{'B', 'L', 'M', '1'}
+
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter")
+
+// BloomFilter is a compact set of strings. Contains can report a string that
+// was never added, with a rate chosen at creation, but never misses one that was.
+type BloomFilter struct {
+	bits   []byte
+	size   uint64
+	hashes uint32
+}
+
+// NewBloomFilter sizes a filter for n strings with the given false positive rate
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	n = max(n, 1)
+	size := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(max(1, math.Round(float64(size)/float64(n)*math.Ln2)))
+	return &BloomFilter{
+		bits:   make([]byte, (size+7)/8),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// positions derives the bits of s by double hashing a single SHA-256 digest
+func (filter *BloomFilter) positions(s string) []uint64 {
+	sum := sha256.Sum256([]byte(s))
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16])
+	positions := make([]uint64, filter.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % filter.size
+	}
+	return positions
+}
+
+// Add puts s in the filter
+func (filter *BloomFilter) Add(s string) {
+	for _, position := range filter.positions(s) {
+		filter.bits[position/8] |= 1 << (position % 8)
+	}
+}
+
+// Contains reports whether s was probably added to the filter
+func (filter *BloomFilter) Contains(s string) bool {
+	for _, position := range filter.positions(s) {
+		if filter.bits[position/8]&(1<<(position%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo serializes the filter, ReadBloomFilter loads it back
+func (filter *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 16)
+	copy(header, bloomFilterMagic[:])
+	binary.BigEndian.PutUint32(header[4:8], filter.hashes)
+	binary.BigEndian.PutUint64(header[8:16], filter.size)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(filter.bits)
+	return int64(n + m), err
+}
+
+// ReadBloomFilter loads a filter written by BloomFilter.WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, ErrInvalidBloomFilter
+	}
+	if [4]byte(header[0:4]) != bloomFilterMagic {
+		return nil, ErrInvalidBloomFilter
+	}
+	filter := &BloomFilter{
+		hashes: binary.BigEndian.Uint32(header[4:8]),
+		size:   binary.BigEndian.Uint64(header[8:16]),
+	}
+	if filter.hashes == 0 || filter.size == 0 {
+		return nil, ErrInvalidBloomFilter
+	}
+	filter.bits = make([]byte, (filter.size+7)/8)
+	if _, err := io.ReadFull(reader, filter.bits); err != nil {
+		return nil, ErrInvalidBloomFilter
+	}
+	return filter, nil
+}
@@ -1,20 +1,88 @@
 package utils
 
 import (
-	"github.com/spf13/viper"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/spf13/viper"
 )
 
 // Config stores all configuration of the application
 // The values are read by viper from a config file or environment variables
 type Config struct {
-	DBDriver            string        `mapstructure:"DB_DRIVER"`
-	DBSource            string        `mapstructure:"DB_SOURCE"`
-	ServerAddress       string        `mapstructure:"SERVER_ADDRESS"`
-	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	BlogMicroURL        string        `mapstructure:"BLOG_MICRO_URL"`
-	AdminPassword       string        `mapstructure:"ADMIN_PASSWORD"`
+	DBDriver                    string        `mapstructure:"DB_DRIVER"`
+	DBSource                    string        `mapstructure:"DB_SOURCE"`
+	ServerAddress               string        `mapstructure:"SERVER_ADDRESS"`
+	TokenType                   string        `mapstructure:"TOKEN_TYPE"`
+	TokenSymmetricKey           string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	TokenAsymmetricKey          string        `mapstructure:"TOKEN_ASYMMETRIC_KEY"`
+	TokenPrivateKeyFile         string        `mapstructure:"TOKEN_PRIVATE_KEY_FILE"`
+	TokenVerificationKeys       []string      `mapstructure:"TOKEN_VERIFICATION_KEYS"`
+	TokenVerificationKeyFiles   []string      `mapstructure:"TOKEN_VERIFICATION_KEY_FILES"`
+	TokenIssuer                 string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience               string        `mapstructure:"TOKEN_AUDIENCE"`
+	TokenExchangeAudiences      []string      `mapstructure:"TOKEN_EXCHANGE_AUDIENCES"`
+	AccessTokenDuration         time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration        time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	ServiceTokenDuration        time.Duration `mapstructure:"SERVICE_TOKEN_DURATION"`
+	ImpersonationDuration       time.Duration `mapstructure:"IMPERSONATION_DURATION"`
+	EmailVerificationDuration   time.Duration `mapstructure:"EMAIL_VERIFICATION_DURATION"`
+	PasswordResetDuration       time.Duration `mapstructure:"PASSWORD_RESET_DURATION"`
+	MFATokenDuration            time.Duration `mapstructure:"MFA_TOKEN_DURATION"`
+	MagicLinkDuration           time.Duration `mapstructure:"MAGIC_LINK_DURATION"`
+	AccountDeletionGracePeriod  time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	UsernameReservationPeriod   time.Duration `mapstructure:"USERNAME_RESERVATION_PERIOD"`
+	LoginMaxAttempts            int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginIPMaxAttempts          int           `mapstructure:"LOGIN_IP_MAX_ATTEMPTS"`
+	LoginLockoutDuration        time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	PasswordMinLength           int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMinCharacterClasses int           `mapstructure:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	PasswordRejectUsername      bool          `mapstructure:"PASSWORD_REJECT_USERNAME"`
+	PasswordCheckBreached       bool          `mapstructure:"PASSWORD_CHECK_BREACHED"`
+	PasswordBreachedFile        string        `mapstructure:"PASSWORD_BREACHED_FILE"`
+	PasswordHashAlgorithm       string        `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	PasswordArgon2Time          uint32        `mapstructure:"PASSWORD_ARGON2_TIME"`
+	PasswordArgon2Memory        uint32        `mapstructure:"PASSWORD_ARGON2_MEMORY"`
+	PasswordArgon2Threads       uint8         `mapstructure:"PASSWORD_ARGON2_THREADS"`
+	PasswordBcryptCost          int           `mapstructure:"PASSWORD_BCRYPT_COST"`
+	OIDCProviders               []string      `mapstructure:"OIDC_PROVIDERS"`
+	OIDCLoginDuration           time.Duration `mapstructure:"OIDC_LOGIN_DURATION"`
+	AuthorizationCodeDuration   time.Duration `mapstructure:"AUTHORIZATION_CODE_DURATION"`
+	ConsentURL                  string        `mapstructure:"CONSENT_URL"`
+	PublicURL                   string        `mapstructure:"PUBLIC_URL"`
+	AMQPURL                     string        `mapstructure:"AMQP_URL"`
+	NotificationExchange        string        `mapstructure:"NOTIFICATION_EXCHANGE"`
+	NotificationRoutingKey      string        `mapstructure:"NOTIFICATION_ROUTING_KEY"`
+	BlogMicroURL                string        `mapstructure:"BLOG_MICRO_URL"`
+	AdminPassword               string        `mapstructure:"ADMIN_PASSWORD"`
+}
+
+// OIDCProvider is an external OpenID Connect provider users can sign in with
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// OIDCProviderConfigs parses OIDC_PROVIDERS, a comma separated list of
+// name|issuer|client_id|client_secret entries
+func (config Config) OIDCProviderConfigs() ([]OIDCProvider, error) {
+	providers := make([]OIDCProvider, 0, len(config.OIDCProviders))
+	for _, entry := range config.OIDCProviders {
+		fields := strings.SplitN(entry, "|", 4)
+		if len(fields) != 4 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("invalid OIDC provider %q: expected name|issuer|client_id|client_secret", fields[0])
+		}
+		providers = append(providers, OIDCProvider{
+			Name:         fields[0],
+			Issuer:       fields[1],
+			ClientID:     fields[2],
+			ClientSecret: fields[3],
+		})
+	}
+	return providers, nil
 }
 
 // LoadConfig reads configuration file or environment variables.
@@ -32,3 +100,13 @@ func LoadConfig(path string) (config Config, err error) {
 	err = viper.Unmarshal(&config)
 	return
 }
+
+// ReloadConfig reads the configuration again from the path given to LoadConfig
+func ReloadConfig() (config Config, err error) {
+	err = viper.ReadInConfig()
+	if err != nil {
+		return
+	}
+	err = viper.Unmarshal(&config)
+	return
+}
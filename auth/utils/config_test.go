@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCProviderConfigs(t *testing.T) {
+	config := Config{OIDCProviders: []string{
+		"google|https://accounts.google.com|client-id|secret|with|pipes",
+	}}
+	providers, err := config.OIDCProviderConfigs()
+	require.NoError(t, err)
+	require.Equal(t, []OIDCProvider{{
+		Name:         "google",
+		Issuer:       "https://accounts.google.com",
+		ClientID:     "client-id",
+		ClientSecret: "secret|with|pipes",
+	}}, providers)
+
+	config.OIDCProviders = []string{"google|https://accounts.google.com"}
+	_, err = config.OIDCProviderConfigs()
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+//go:build ignore
+
+// gen_breached_passwords builds the bloom filter checked by NotBreached from
+// a list of passwords, one per line
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"shivesh-ranjan.github.io/m/utils"
+)
+
+func main() {
+	in := flag.String("in", "breached_passwords.txt", "list of passwords, one per line")
+	out := flag.String("out", "breached_passwords.bloom", "bloom filter to write")
+	falsePositiveRate := flag.Float64("fp", 0.0001, "false positive rate of the filter")
+	flag.Parse()
+
+	file, err := os.Open(*in)
+	if err != nil {
+		log.Fatal("cannot open password list: ", err)
+	}
+	defer file.Close()
+	var passwords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			passwords = append(passwords, password)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal("cannot read password list: ", err)
+	}
+
+	filter := utils.NewBloomFilter(len(passwords), *falsePositiveRate)
+	for _, password := range passwords {
+		filter.Add(password)
+	}
+	output, err := os.Create(*out)
+	if err != nil {
+		log.Fatal("cannot create bloom filter: ", err)
+	}
+	defer output.Close()
+	if _, err := filter.WriteTo(output); err != nil {
+		log.Fatal("cannot write bloom filter: ", err)
+	}
+	log.Printf("wrote %d passwords to %s", len(passwords), *out)
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run gen_breached_passwords.go -in breached_passwords.txt -out breached_passwords.bloom
+
+// breachedPasswords is a bloom filter of commonly breached passwords, built
+// from breached_passwords.txt
+//
+//go:embed breached_passwords.bloom
+var breachedPasswords []byte
+
+// Codes of the rules a password can break
+const (
+	PasswordTooShort         = "too_short"
+	PasswordTooLong          = "too_long"
+	PasswordTooSimple        = "too_simple"
+	PasswordSimilarUsername  = "similar_to_username"
+	PasswordBreached         = "breached"
+	maxPasswordLength        = 256
+	maxBcryptPasswordLength  = 72 // bcrypt cannot hash anything longer
+	minUsernameSimilarLength = 3
+)
+
+// PasswordViolation is a rule a password breaks
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password breaks
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (err *PasswordPolicyError) Error() string {
+	messages := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// PasswordRule checks the password chosen by username, it returns nil when the password passes
+type PasswordRule func(password string, username string) *PasswordViolation
+
+// PasswordPolicy is the set of rules new passwords must pass
+type PasswordPolicy struct {
+	rules []PasswordRule
+}
+
+func NewPasswordPolicy(rules ...PasswordRule) *PasswordPolicy {
+	return &PasswordPolicy{rules: rules}
+}
+
+// Validate returns a *PasswordPolicyError when the password breaks any rule
+func (policy *PasswordPolicy) Validate(password string, username string) error {
+	var violations []PasswordViolation
+	for _, rule := range policy.rules {
+		if violation := rule(password, username); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// MinLength requires at least n characters
+func MinLength(n int) PasswordRule {
+	return func(password string, username string) *PasswordViolation {
+		if len([]rune(password)) >= n {
+			return nil
+		}
+		return &PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", n),
+		}
+	}
+}
+
+// MaxLength allows at most n bytes
+func MaxLength(n int) PasswordRule {
+	return func(password string, username string) *PasswordViolation {
+		if len(password) <= n {
+			return nil
+		}
+		return &PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d bytes long", n),
+		}
+	}
+}
+
+// CharacterClasses requires n of lowercase letters, uppercase letters, digits and symbols
+func CharacterClasses(n int) PasswordRule {
+	return func(password string, username string) *PasswordViolation {
+		var lower, upper, digit, symbol bool
+		for _, r := range password {
+			switch {
+			case unicode.IsLower(r):
+				lower = true
+			case unicode.IsUpper(r):
+				upper = true
+			case unicode.IsDigit(r):
+				digit = true
+			default:
+				symbol = true
+			}
+		}
+		classes := 0
+		for _, present := range []bool{lower, upper, digit, symbol} {
+			if present {
+				classes++
+			}
+		}
+		if classes >= n {
+			return nil
+		}
+		return &PasswordViolation{
+			Code:    PasswordTooSimple,
+			Message: fmt.Sprintf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", n),
+		}
+	}
+}
+
+// NotSimilarToUsername rejects passwords that contain the username, or are
+// contained in it, ignoring case
+func NotSimilarToUsername() PasswordRule {
+	return func(password string, username string) *PasswordViolation {
+		password, username = strings.ToLower(password), strings.ToLower(username)
+		if len(username) < minUsernameSimilarLength || len(password) < minUsernameSimilarLength {
+			return nil
+		}
+		if !strings.Contains(password, username) && !strings.Contains(username, password) {
+			return nil
+		}
+		return &PasswordViolation{
+			Code:    PasswordSimilarUsername,
+			Message: "password must not be similar to the username",
+		}
+	}
+}
+
+// NotBreached rejects passwords found in the filter. Passwords are looked up
+// as they are and in lowercase.
+func NotBreached(filter *BloomFilter) PasswordRule {
+	return func(password string, username string) *PasswordViolation {
+		if !filter.Contains(password) && !filter.Contains(strings.ToLower(password)) {
+			return nil
+		}
+		return &PasswordViolation{
+			Code:    PasswordBreached,
+			Message: "password appears in a list of breached passwords",
+		}
+	}
+}
+
+// LoadBreachedPasswords reads a bloom filter written by gen_breached_passwords.go,
+// an empty file name loads the bundled list
+func LoadBreachedPasswords(file string) (*BloomFilter, error) {
+	if file == "" {
+		return ReadBloomFilter(bytes.NewReader(breachedPasswords))
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBloomFilter(f)
+}
+
+// PasswordPolicy builds the policy configured by the PASSWORD_* settings,
+// a zero setting turns its rule off
+func (config Config) PasswordPolicy() (*PasswordPolicy, error) {
+	maxLength := maxPasswordLength
+	if config.PasswordHashAlgorithm == HashBcrypt {
+		maxLength = maxBcryptPasswordLength
+	}
+	rules := []PasswordRule{MaxLength(maxLength)}
+	if config.PasswordMinLength > 0 {
+		rules = append(rules, MinLength(config.PasswordMinLength))
+	}
+	if config.PasswordMinCharacterClasses > 0 {
+		rules = append(rules, CharacterClasses(config.PasswordMinCharacterClasses))
+	}
+	if config.PasswordRejectUsername {
+		rules = append(rules, NotSimilarToUsername())
+	}
+	if config.PasswordCheckBreached {
+		filter, err := LoadBreachedPasswords(config.PasswordBreachedFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load breached passwords: %w", err)
+		}
+		rules = append(rules, NotBreached(filter))
+	}
+	return NewPasswordPolicy(rules...), nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(100, 0.001)
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = RandomString(12)
+		filter.Add(words[i])
+	}
+	for _, word := range words {
+		require.True(t, filter.Contains(word))
+	}
+
+	var buf bytes.Buffer
+	_, err := filter.WriteTo(&buf)
+	require.NoError(t, err)
+	loaded, err := ReadBloomFilter(&buf)
+	require.NoError(t, err)
+	require.Equal(t, filter, loaded)
+
+	_, err = ReadBloomFilter(strings.NewReader("not a filter"))
+	require.ErrorIs(t, err, ErrInvalidBloomFilter)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached, err := LoadBreachedPasswords("")
+	require.NoError(t, err)
+	require.True(t, breached.Contains("password"))
+	require.False(t, breached.Contains(RandomString(16)))
+
+	policy := NewPasswordPolicy(
+		MinLength(10),
+		MaxLength(maxPasswordLength),
+		CharacterClasses(3),
+		NotSimilarToUsername(),
+		NotBreached(breached),
+	)
+	require.NoError(t, policy.Validate("Correct-Horse-Battery", "alice"))
+
+	testCases := []struct {
+		password string
+		codes    []string
+	}{
+		{"Sh0rt!", []string{PasswordTooShort}},
+		{strings.Repeat("Aa1!", 70), []string{PasswordTooLong}},
+		{"alllowercase", []string{PasswordTooSimple}},
+		{"Alice-In-Wonderland", []string{PasswordSimilarUsername}},
+		{"Password123", []string{PasswordBreached}},
+		{"PASSWORD", []string{PasswordTooShort, PasswordTooSimple, PasswordBreached}},
+	}
+	for _, tc := range testCases {
+		err := policy.Validate(tc.password, "alice")
+		var policyErr *PasswordPolicyError
+		require.ErrorAs(t, err, &policyErr, tc.password)
+		codes := make([]string, len(policyErr.Violations))
+		for i, violation := range policyErr.Violations {
+			codes[i] = violation.Code
+		}
+		require.Equal(t, tc.codes, codes, tc.password)
+	}
+}
+
+func TestConfigPasswordPolicy(t *testing.T) {
+	policy, err := Config{}.PasswordPolicy()
+	require.NoError(t, err)
+	require.NoError(t, policy.Validate("a", "a"))
+
+	_, err = Config{PasswordCheckBreached: true, PasswordBreachedFile: "missing.bloom"}.PasswordPolicy()
+	require.Error(t, err)
+}
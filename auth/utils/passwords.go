@@ -1,21 +1,202 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the Brcypt hash of the password
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("Can't hash the password: %s", err)
+// Algorithms new passwords can be hashed with. Every hash records the
+// algorithm and parameters it was made with, so hashes made with older
+// settings keep verifying.
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+// Argon2Params tune the cost of argon2id hashes, Memory is in KiB
+type Argon2Params struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id
+var DefaultArgon2Params = Argon2Params{
+	Time:       3,
+	Memory:     64 * 1024,
+	Threads:    2,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// PasswordHasher hashes new passwords with one algorithm and checks hashes of any of them
+type PasswordHasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+func NewPasswordHasher(algorithm string, argon2Params Argon2Params, bcryptCost int) (*PasswordHasher, error) {
+	switch algorithm {
+	case HashArgon2id:
+		if argon2Params.Time == 0 || argon2Params.Memory == 0 || argon2Params.Threads == 0 ||
+			argon2Params.SaltLength == 0 || argon2Params.KeyLength == 0 {
+			return nil, errors.New("argon2id parameters must not be zero")
+		}
+	case HashBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %s", algorithm)
 	}
-	return string(hashedPassword), nil
+	return &PasswordHasher{algorithm: algorithm, argon2: argon2Params, bcryptCost: bcryptCost}, nil
+}
+
+var defaultPasswordHasher = &PasswordHasher{
+	algorithm:  HashArgon2id,
+	argon2:     DefaultArgon2Params,
+	bcryptCost: bcrypt.DefaultCost,
+}
+
+// HashPassword returns the argon2id hash of the password with the default parameters
+func HashPassword(password string) (string, error) {
+	return defaultPasswordHasher.Hash(password)
 }
 
 // CheckPassword crosschecks the hash of the input password with the actual one
 func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return defaultPasswordHasher.Check(password, hashedPassword)
+}
+
+// Hash returns the hash of the password
+func (hasher *PasswordHasher) Hash(password string) (string, error) {
+	if hasher.algorithm == HashBcrypt {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), hasher.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("Can't hash the password: %s", err)
+		}
+		return string(hashedPassword), nil
+	}
+	salt := make([]byte, hasher.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("Can't hash the password: %s", err)
+	}
+	params := hasher.argon2
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Check returns ErrPasswordMismatch unless hashedPassword is a hash of password
+func (hasher *PasswordHasher) Check(password string, hashedPassword string) error {
+	if isBcryptHash(hashedPassword) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+	params, salt, key, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return err
+	}
+	derived := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hashedPassword was made with another algorithm
+// or other parameters than the hasher would use now
+func (hasher *PasswordHasher) NeedsRehash(hashedPassword string) bool {
+	if isBcryptHash(hashedPassword) {
+		if hasher.algorithm != HashBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		return err == nil && cost != hasher.bcryptCost
+	}
+	params, salt, _, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return false
+	}
+	if hasher.algorithm != HashArgon2id {
+		return true
+	}
+	params.SaltLength = uint32(len(salt))
+	return params != hasher.argon2
+}
+
+func isBcryptHash(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") ||
+		strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+// parseArgon2Hash splits a hash in the $argon2id$v=19$m=..,t=..,p=..$salt$key format
+func parseArgon2Hash(hashedPassword string) (params Argon2Params, salt []byte, key []byte, err error) {
+	fields := strings.Split(hashedPassword, "$")
+	if len(fields) != 6 || fields[0] != "" || fields[1] != HashArgon2id {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// PasswordHasher builds the hasher configured by PASSWORD_HASH_ALGORITHM,
+// PASSWORD_ARGON2_* and PASSWORD_BCRYPT_COST, zero settings fall back to the defaults
+func (config Config) PasswordHasher() (*PasswordHasher, error) {
+	algorithm := config.PasswordHashAlgorithm
+	if algorithm == "" {
+		algorithm = HashArgon2id
+	}
+	params := DefaultArgon2Params
+	if config.PasswordArgon2Time > 0 {
+		params.Time = config.PasswordArgon2Time
+	}
+	if config.PasswordArgon2Memory > 0 {
+		params.Memory = config.PasswordArgon2Memory
+	}
+	if config.PasswordArgon2Threads > 0 {
+		params.Threads = config.PasswordArgon2Threads
+	}
+	cost := bcrypt.DefaultCost
+	if config.PasswordBcryptCost > 0 {
+		cost = config.PasswordBcryptCost
+	}
+	return NewPasswordHasher(algorithm, params, cost)
 }
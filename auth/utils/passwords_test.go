@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestPassword(t *testing.T) {
@@ -12,11 +14,52 @@ func TestPassword(t *testing.T) {
 	result, err := HashPassword(password)
 	require.NoError(t, err)
 	require.NotEmpty(t, result)
+	require.True(t, strings.HasPrefix(result, "$argon2id$v=19$m=65536,t=3,p=2$"))
 
 	error := CheckPassword(password, result)
 	require.NoError(t, error)
 
 	wrong := RandomString(6)
 	err = CheckPassword(wrong, result)
+	require.ErrorIs(t, err, ErrPasswordMismatch)
+}
+
+func TestPasswordHasher(t *testing.T) {
+	password := RandomString(12)
+	cheap := Argon2Params{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+	hasher, err := NewPasswordHasher(HashArgon2id, cheap, bcrypt.MinCost)
+	require.NoError(t, err)
+
+	argon2Hash, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(password, argon2Hash))
+	require.False(t, hasher.NeedsRehash(argon2Hash))
+
+	// bcrypt hashes made before argon2id keep working but get replaced
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(password, string(bcryptHash)))
+	require.ErrorIs(t, hasher.Check("wrong", string(bcryptHash)), ErrPasswordMismatch)
+	require.True(t, hasher.NeedsRehash(string(bcryptHash)))
+
+	// so do hashes with older parameters
+	stronger := cheap
+	stronger.Time = 2
+	upgraded, err := NewPasswordHasher(HashArgon2id, stronger, bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, upgraded.Check(password, argon2Hash))
+	require.True(t, upgraded.NeedsRehash(argon2Hash))
+
+	bcryptHasher, err := NewPasswordHasher(HashBcrypt, cheap, bcrypt.MinCost+1)
+	require.NoError(t, err)
+	require.True(t, bcryptHasher.NeedsRehash(argon2Hash))
+	require.True(t, bcryptHasher.NeedsRehash(string(bcryptHash)))
+
+	require.ErrorIs(t, hasher.Check(password, "plaintext"), ErrUnknownPasswordHash)
+	require.False(t, hasher.NeedsRehash("plaintext"))
+
+	_, err = NewPasswordHasher("md5", cheap, bcrypt.MinCost)
+	require.Error(t, err)
+	_, err = NewPasswordHasher(HashArgon2id, Argon2Params{}, bcrypt.MinCost)
 	require.Error(t, err)
 }
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotpCode(t *testing.T) {
+	// test vectors of RFC 6238 for SHA1, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := TotpCode(secret, TotpCounter(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, expected, code)
+	}
+
+	_, err := TotpCode("not base32!", 1)
+	require.Error(t, err)
+}
+
+func TestValidateTotp(t *testing.T) {
+	secret, err := NewTotpSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	code, err := TotpCode(secret, TotpCounter(now))
+	require.NoError(t, err)
+	counter, ok := ValidateTotp(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, TotpCounter(now), counter)
+
+	// clocks may drift by one period
+	previous, err := TotpCode(secret, TotpCounter(now)-1)
+	require.NoError(t, err)
+	_, ok = ValidateTotp(secret, previous, now)
+	require.True(t, ok)
+
+	stale, err := TotpCode(secret, TotpCounter(now)-2)
+	require.NoError(t, err)
+	_, ok = ValidateTotp(secret, stale, now)
+	require.False(t, ok)
+
+	_, ok = ValidateTotp(secret, "12345", now)
+	require.False(t, ok)
+}
+
+func TestTotpProvisioningURI(t *testing.T) {
+	secret, err := NewTotpSecret()
+	require.NoError(t, err)
+
+	uri, err := url.Parse(TotpProvisioningURI("auth", "alice", secret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/auth:alice", uri.Path)
+	require.Equal(t, secret, uri.Query().Get("secret"))
+	require.Equal(t, "auth", uri.Query().Get("issuer"))
+}
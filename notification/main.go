@@ -7,6 +7,7 @@ import (
 	"net/smtp"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/joho/godotenv"
@@ -24,8 +25,20 @@ var (
 	emailPassword string
 )
 
+// Message types. Messages without a type are topic summaries from topicTracker.
+const (
+	messageTypeSummary                  = "summary"
+	messageTypeEmailVerification        = "email_verification"
+	messageTypePasswordReset            = "password_reset"
+	messageTypePasswordChanged          = "password_changed"
+	messageTypeNewSignIn                = "new_sign_in"
+	messageTypeMagicLink                = "magic_link"
+	messageTypeAccountDeletionScheduled = "account_deletion_scheduled"
+)
+
 // Message represents the structure of RabbitMQ message
 type Message struct {
+	Type    string   `json:"type"`
 	Email   string   `json:"email"`
 	Links   []string `json:"links"`
 	Summary string   `json:"summary"`
@@ -55,19 +68,68 @@ func getEnv(key string) string {
 	return value
 }
 
-func sendEmail(toEmail string, summary string, links []string) {
+// composeEmail returns the subject and body of the email for a message
+func composeEmail(msg Message) (string, string, error) {
+	switch msg.Type {
+	case "", messageTypeSummary:
+		body := fmt.Sprintf(
+			"Hello,\n\nHere is your summary:\n\n%s\n\nLinks:\n%s\n\nBest regards.",
+			msg.Summary,
+			formatLinks(msg.Links),
+		)
+		return "Summary and Links", body, nil
+	case messageTypeEmailVerification:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\n%s\nIf you did not create an account, you can ignore this email.\n\nBest regards.",
+			msg.Summary,
+			formatLinks(msg.Links),
+		)
+		return "Verify your email address", body, nil
+	case messageTypePasswordReset:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\n%s\nIf you did not ask for this, you can ignore this email and your password will stay the same.\n\nBest regards.",
+			msg.Summary,
+			formatLinks(msg.Links),
+		)
+		return "Reset your password", body, nil
+	case messageTypePasswordChanged:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\nIf you did not do this, reset your password right away.\n\nBest regards.",
+			msg.Summary,
+		)
+		return "Your password was changed", body, nil
+	case messageTypeNewSignIn:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\nIf this was you, there is nothing to do. If not, change your password and sign out your other sessions right away.\n\nBest regards.",
+			msg.Summary,
+		)
+		return "New sign-in to your account", body, nil
+	case messageTypeMagicLink:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\n%s\nThe link works once and expires soon. If you did not ask for it, you can ignore this email.\n\nBest regards.",
+			msg.Summary,
+			formatLinks(msg.Links),
+		)
+		return "Your sign-in link", body, nil
+	case messageTypeAccountDeletionScheduled:
+		body := fmt.Sprintf(
+			"Hello,\n\n%s\n\nSign in again before then if you want to keep your account.\n\nBest regards.",
+			msg.Summary,
+		)
+		return "Your account will be deleted", body, nil
+	default:
+		return "", "", fmt.Errorf("unknown message type %s", msg.Type)
+	}
+}
+
+func sendEmail(toEmail string, subject string, body string) {
 	log.Print("Recieved email for sending...")
-	body := fmt.Sprintf(
-		"Hello,\n\nHere is your summary:\n\n%s\n\nLinks:\n%s\n\nBest regards.",
-		summary,
-		formatLinks(links),
-	)
 
 	log.Print("Doing plain auth for smtp...")
 	auth := smtp.PlainAuth("", emailUser, emailPassword, smtpServer)
 	msg := []byte(fmt.Sprintf(
-		"From: %s\nTo: %s\nSubject: Summary and Links\nContent-Type: text/plain; charset=\"utf-8\"\n\n%s",
-		emailUser, toEmail, body,
+		"From: %s\nTo: %s\nSubject: %s\nContent-Type: text/plain; charset=\"utf-8\"\n\n%s",
+		emailUser, toEmail, subject, body,
 	))
 
 	log.Print("Sending mail to cleint...")
@@ -79,6 +141,17 @@ func sendEmail(toEmail string, summary string, links []string) {
 	}
 }
 
+// needsLinks reports whether emails of a message type are pointless without
+// links, account alerts only carry a summary
+func needsLinks(messageType string) bool {
+	switch messageType {
+	case messageTypePasswordChanged, messageTypeNewSignIn, messageTypeAccountDeletionScheduled:
+		return false
+	default:
+		return true
+	}
+}
+
 func formatLinks(links []string) string {
 	formatted := ""
 	for _, link := range links {
@@ -99,13 +172,19 @@ func handleMessage(d amqp.Delivery) {
 	}
 
 	log.Printf("Processing email: %s", msg.Email)
-	if msg.Email == "" || msg.Summary == "" || len(msg.Links) == 0 {
+	if msg.Email == "" || msg.Summary == "" || (len(msg.Links) == 0 && needsLinks(msg.Type)) {
 		log.Printf("Invalid message: Missing email, summary, or links")
 		d.Nack(false, false)
 		return
 	}
 
-	sendEmail(msg.Email, msg.Summary, msg.Links)
+	subject, body, err := composeEmail(msg)
+	if err != nil {
+		log.Printf("Invalid message: %v", err)
+		d.Nack(false, false)
+		return
+	}
+	sendEmail(msg.Email, subject, body)
 
 	err = d.Ack(false)
 	if err != nil {
@@ -138,9 +217,12 @@ func main() {
 		log.Fatalf("Failed to declare queue: %v", err)
 	}
 
-	err = ch.QueueBind(queueName, routingKey, exchangeName, false, nil)
-	if err != nil {
-		log.Fatalf("Failed to bind queue: %v", err)
+	// ROUTING_KEY may list several keys, e.g. "summary.email,account.email"
+	for _, key := range strings.Split(routingKey, ",") {
+		err = ch.QueueBind(queueName, strings.TrimSpace(key), exchangeName, false, nil)
+		if err != nil {
+			log.Fatalf("Failed to bind queue: %v", err)
+		}
 	}
 
 	msgs, err := ch.Consume(queueName, "", false, false, false, false, nil)